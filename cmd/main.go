@@ -4,11 +4,17 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"go-chat/internal/api"
+	"go-chat/internal/auth"
 	"go-chat/internal/config"
+	"go-chat/internal/mail"
+	"go-chat/internal/oidc"
 	"go-chat/internal/repository"
+	"go-chat/internal/storage"
+	"go-chat/internal/unfurl"
 	"go-chat/internal/validator"
 	"go-chat/internal/websocket"
 
@@ -45,35 +51,237 @@ func main() {
 
 	userRepo := repository.NewUserRepository(dbpool)
 	roomRepo := repository.NewRoomRepository(dbpool)
+	reactionRepo := repository.NewReactionRepository(dbpool)
+	attachmentRepo := repository.NewAttachmentRepository(dbpool)
+	readRepo := repository.NewReadRepository(dbpool)
+	sessionRepo := repository.NewSessionRepository(dbpool)
+	userTokenRepo := repository.NewUserTokenRepository(dbpool)
+	twoFactorRepo := repository.NewTwoFactorRepository(dbpool)
+	loginThrottleRepo := repository.NewLoginThrottleRepository(dbpool)
+	identityRepo := repository.NewIdentityRepository(dbpool)
+
+	// Хранилище вложений
+	var fileStorage storage.Storage
+	switch cfg.StorageBackend {
+	case "local":
+		fileStorage, err = storage.NewLocalStorage(cfg.StorageLocalDir)
+	case "s3":
+		fileStorage, err = storage.NewS3Storage(storage.S3Config{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.S3Bucket,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+		})
+	default:
+		err = fmt.Errorf("неизвестный STORAGE_BACKEND: %q", cfg.StorageBackend)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка инициализации хранилища вложений: %v\n", err)
+		os.Exit(1)
+	}
+	sweeper := storage.NewSweeper(fileStorage, attachmentRepo, cfg.UnlinkedAttachmentTTL, cfg.StorageSweepInterval)
+	go sweeper.Run(context.Background())
+
+	// Отправка писем
+	var mailer mail.Mailer
+	switch cfg.Mailer {
+	case "log":
+		mailer = mail.NewLogMailer(cfg.MailFrom)
+	case "file":
+		mailer, err = mail.NewFileMailer(cfg.MailDir, cfg.MailFrom)
+	case "smtp":
+		mailer, err = mail.NewSMTPMailer(mail.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		})
+	default:
+		err = fmt.Errorf("неизвестный MAILER: %q", cfg.Mailer)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка инициализации отправки писем: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Создаем менеджер хабов
 	hubManager := websocket.NewHubManager()
+	switch cfg.Broadcaster {
+	case "memory":
+	case "postgres":
+		broadcaster := websocket.NewPGBroadcaster(dbpool, hubManager)
+		go broadcaster.Listen(context.Background())
+		hubManager.SetBroadcaster(broadcaster)
+		fmt.Println("События WebSocket рассылаются через Postgres LISTEN/NOTIFY.")
+	default:
+		fmt.Fprintf(os.Stderr, "Неизвестный BROADCASTER: %q\n", cfg.Broadcaster)
+		os.Exit(1)
+	}
+	hubManager.SetPresenceStore(userRepo)
 	fmt.Println("WebSocket Hub Manager запущен.")
 
-	userHandler := api.NewUserHandler(userRepo, cfg)
-	roomHandler := api.NewRoomHandler(roomRepo, hubManager)
-	wsHandler := api.NewWebSocketHandler(hubManager)
+	// Карточки ссылок строятся в фоне
+	var unfurler *unfurl.Worker
+	if cfg.LinkPreviews {
+		allowedNetworks, err := unfurl.ParseNetworks(cfg.LinkPreviewAllowedNetworks)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Некорректный LINK_PREVIEW_ALLOWED_NETWORKS: %v\n", err)
+			os.Exit(1)
+		}
+		client := unfurl.NewHTTPClient(unfurl.ClientConfig{
+			Timeout:         cfg.LinkPreviewTimeout,
+			AllowedNetworks: allowedNetworks,
+		})
+		fetcher := unfurl.NewFetcher(client, cfg.LinkPreviewMaxBytes)
+		unfurler = unfurl.NewWorker(fetcher, repository.NewLinkPreviewRepository(dbpool), roomRepo, hubManager, cfg.LinkPreviewCacheTTL)
+		go unfurler.Run(context.Background(), cfg.LinkPreviewWorkers)
+	}
+
+	v := validator.NewValidator()
+
+	// Ключи подписи access-токенов
+	keyRing, err := auth.NewKeyRing(auth.KeyRingConfig{
+		Dir:              cfg.JWTKeyDir,
+		Algorithm:        cfg.JWTAlgorithm,
+		RotationInterval: cfg.JWTKeyRotation,
+		// Замененный ключ нужен, пока не истекут подписанные им токены.
+		RetainFor:          cfg.AccessTokenTTL + time.Minute,
+		LegacySecret:       cfg.JWTSecret,
+		LegacyIssuedBefore: cfg.JWTSecretRetiredAt,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка загрузки ключей подписи JWT: %v\n", err)
+		os.Exit(1)
+	}
+	go keyRing.Run(context.Background())
+
+	authService := auth.NewService(sessionRepo, userRepo, keyRing, cfg.AccessTokenTTL, cfg.RefreshTokenTTL)
+	// Соединения отозванных сессий закрываются сразу, не дожидаясь истечения access-токена.
+	authService.SetRevocationNotifier(hubManager)
+	accountService := auth.NewAccountService(userRepo, userTokenRepo, mailer, authService, auth.AccountConfig{
+		AppURL:           cfg.AppURL,
+		VerificationTTL:  cfg.EmailVerificationTTL,
+		PasswordResetTTL: cfg.PasswordResetTTL,
+	})
+	loginGuard := auth.NewLoginGuard(loginThrottleRepo, userRepo, auth.LoginGuardConfig{
+		MaxFailures:   cfg.LoginMaxFailures,
+		Backoff:       cfg.LoginBackoff,
+		Lockout:       cfg.LoginLockout,
+		FailureWindow: cfg.LoginFailureWindow,
+		IPMaxFailures: cfg.LoginIPMaxFailures,
+		IPWindow:      cfg.LoginIPWindow,
+	})
+	twoFactorService := auth.NewTwoFactorService(twoFactorRepo, userRepo, authService, loginGuard, cfg.MFAIssuer, cfg.MFAChallengeTTL)
+	// Вход через провайдера OpenID Connect
+	var ssoHandler *api.SSOHandler
+	if cfg.OIDCIssuer != "" {
+		provider := oidc.NewProvider(oidc.Config{
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       cfg.OIDCScopes,
+		})
+		ssoService := auth.NewSSOService(provider, identityRepo, userRepo, cfg.OIDCAutoProvision)
+		ssoHandler = api.NewSSOHandler(ssoService, authService, twoFactorService, strings.HasPrefix(cfg.OIDCRedirectURL, "https://"), "/api/v1/oidc")
+	}
+	postingPolicy := api.NewPostingPolicy(userRepo, cfg.RequireVerifiedEmail)
+	userHandler := api.NewUserHandler(userRepo, authService, accountService, twoFactorService, loginGuard, cfg)
+	twoFactorHandler := api.NewTwoFactorHandler(userRepo, twoFactorService)
+	accountHandler := api.NewAccountHandler(userRepo, accountService)
+	roomHandler := api.NewRoomHandler(roomRepo, hubManager, unfurler, postingPolicy)
+	dmHandler := api.NewDirectMessageHandler(roomRepo, userRepo)
+	reactionHandler := api.NewReactionHandler(roomRepo, reactionRepo, hubManager)
+	searchHandler := api.NewSearchHandler(roomRepo)
+	readHandler := api.NewReadHandler(roomRepo, readRepo, hubManager)
+	presenceHandler := api.NewPresenceHandler(roomRepo, userRepo, hubManager)
+	attachmentHandler := api.NewAttachmentHandler(roomRepo, attachmentRepo, fileStorage, cfg.MaxAttachmentSize, cfg.AllowedAttachmentTypes, postingPolicy)
+	sessionHandler := api.NewSessionHandler(authService)
+	jwksHandler := api.NewJWKSHandler(keyRing)
+	wsHandler := api.NewWebSocketHandler(hubManager, roomRepo, readRepo, unfurler, postingPolicy, v)
 
 	e := echo.New()
-	e.Validator = validator.NewValidator()
+	e.Validator = v
+	// IP клиента используется для ограничения попыток входа и в списке сессий,
+	// поэтому заголовкам прокси доверяем только явно.
+	if cfg.TrustProxyHeaders {
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	} else {
+		e.IPExtractor = echo.ExtractIPDirect()
+	}
+
+	// Открытые ключи для проверки токенов другими сервисами
+	e.GET("/.well-known/jwks.json", jwksHandler.GetJWKS)
 
 	apiV1 := e.Group("/api/v1")
 
 	// Публичные маршруты
 	apiV1.POST("/register", userHandler.Register)
 	apiV1.POST("/login", userHandler.Login)
+	apiV1.POST("/login/2fa", userHandler.LoginTwoFactor)
+	apiV1.POST("/refresh", userHandler.Refresh)
+	if ssoHandler != nil {
+		apiV1.GET("/oidc/login", ssoHandler.Login)
+		apiV1.GET("/oidc/callback", ssoHandler.Callback)
+	}
+	apiV1.POST("/password/forgot", accountHandler.ForgotPassword)
+	apiV1.POST("/password/reset", accountHandler.ResetPassword)
+	apiV1.POST("/email/verify", accountHandler.VerifyEmail)
 
 	// Защищенные маршруты
 	protected := apiV1.Group("")
-	protected.Use(api.JWTMiddleware(cfg))
+	protected.Use(api.JWTMiddleware(authService))
 	
 	protected.GET("/me", userHandler.Me)
+	protected.POST("/logout", userHandler.Logout)
+	protected.POST("/email/verification", accountHandler.ResendVerification)
+	protected.POST("/me/2fa", twoFactorHandler.Enroll)
+	protected.POST("/me/2fa/confirm", twoFactorHandler.Confirm)
+	protected.POST("/me/2fa/disable", twoFactorHandler.Disable)
+	protected.GET("/me/sessions", sessionHandler.GetSessions)
+	protected.DELETE("/me/sessions", sessionHandler.RevokeOtherSessions)
+	protected.DELETE("/me/sessions/:id", sessionHandler.RevokeSession)
 
 	// Маршруты для комнат (защищенные)
 	protected.POST("/rooms", roomHandler.CreateRoom)
 	protected.GET("/rooms", roomHandler.GetRooms)
+	protected.PATCH("/rooms/:id", roomHandler.UpdateRoom)
+	protected.DELETE("/rooms/:id", roomHandler.DeleteRoom)
 	protected.POST("/rooms/:id/messages", roomHandler.PostMessage)
+	protected.POST("/rooms/:id/attachments", attachmentHandler.Upload)
 	protected.GET("/rooms/:id/messages", roomHandler.GetMessages)
+	protected.GET("/rooms/:id/messages/search", searchHandler.SearchRoom)
+	protected.PATCH("/rooms/:id/messages/:msg_id", roomHandler.EditMessage)
+	protected.GET("/rooms/:id/messages/:msg_id/replies", roomHandler.GetReplies)
+	protected.GET("/rooms/:id/messages/:msg_id/receipts", readHandler.GetMessageReaders)
+	protected.POST("/rooms/:id/messages/:msg_id/reactions", reactionHandler.AddReaction)
+	protected.DELETE("/rooms/:id/messages/:msg_id/reactions/:emoji", reactionHandler.RemoveReaction)
+	protected.DELETE("/rooms/:id/messages/:msg_id", roomHandler.DeleteMessage)
+	protected.POST("/rooms/:id/read", readHandler.MarkRead)
+	protected.GET("/rooms/:id/receipts", readHandler.GetReceipts)
+	protected.POST("/rooms/:id/join", roomHandler.JoinRoom)
+	protected.POST("/rooms/:id/leave", roomHandler.LeaveRoom)
+	protected.GET("/rooms/:id/members", roomHandler.GetMembers)
+	protected.GET("/rooms/:id/presence", presenceHandler.GetRoomPresence)
+	protected.POST("/rooms/:id/members", roomHandler.AddMember)
+	protected.PUT("/rooms/:id/members/:user_id/role", roomHandler.SetMemberRole)
+	protected.DELETE("/rooms/:id/members/:user_id", roomHandler.KickMember)
+	protected.DELETE("/rooms/:id/bans/:user_id", roomHandler.UnbanMember)
+
+	// Статус пользователей
+	protected.GET("/users/:id/presence", presenceHandler.GetUserPresence)
+
+	// Поиск по всем доступным комнатам
+	protected.GET("/search", searchHandler.SearchAll)
+
+	// Скачивание вложений
+	protected.GET("/attachments/:id", attachmentHandler.Download)
+
+	// Маршруты для личных переписок (защищенные)
+	protected.GET("/dm", dmHandler.GetConversations)
+	protected.POST("/dm/:user_id", dmHandler.OpenConversation)
 
 	// Маршрут для WebSocket
 	protected.GET("/ws/rooms/:id", wsHandler.ServeWs)
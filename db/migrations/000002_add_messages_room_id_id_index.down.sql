@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS "messages_room_id_idx" ON "messages" ("room_id");
+DROP INDEX IF EXISTS "messages_room_id_id_idx";
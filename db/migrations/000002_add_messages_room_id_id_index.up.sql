@@ -0,0 +1,2 @@
+CREATE INDEX "messages_room_id_id_idx" ON "messages" ("room_id", "id");
+DROP INDEX IF EXISTS "messages_room_id_idx";
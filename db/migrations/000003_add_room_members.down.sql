@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "room_members";
+ALTER TABLE "rooms" DROP COLUMN IF EXISTS "visibility";
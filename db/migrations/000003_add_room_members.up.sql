@@ -0,0 +1,13 @@
+ALTER TABLE "rooms" ADD COLUMN "visibility" varchar NOT NULL DEFAULT 'public';
+
+CREATE TABLE "room_members" (
+    "room_id" bigint NOT NULL,
+    "user_id" bigint NOT NULL,
+    "joined_at" timestamptz NOT NULL DEFAULT (now()),
+    PRIMARY KEY ("room_id", "user_id")
+);
+
+ALTER TABLE "room_members" ADD FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON DELETE CASCADE;
+ALTER TABLE "room_members" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+
+CREATE INDEX ON "room_members" ("user_id");
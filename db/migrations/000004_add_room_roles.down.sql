@@ -0,0 +1,5 @@
+ALTER TABLE "messages" DROP CONSTRAINT "messages_room_id_fkey";
+ALTER TABLE "messages" ADD FOREIGN KEY ("room_id") REFERENCES "rooms" ("id");
+
+ALTER TABLE "room_members" DROP COLUMN IF EXISTS "role";
+ALTER TABLE "rooms" DROP COLUMN IF EXISTS "owner_id";
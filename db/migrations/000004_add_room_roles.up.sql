@@ -0,0 +1,8 @@
+ALTER TABLE "rooms" ADD COLUMN "owner_id" bigint;
+ALTER TABLE "rooms" ADD FOREIGN KEY ("owner_id") REFERENCES "users" ("id") ON DELETE SET NULL;
+
+ALTER TABLE "room_members" ADD COLUMN "role" varchar NOT NULL DEFAULT 'member';
+
+-- Удаление комнаты удаляет и ее сообщения.
+ALTER TABLE "messages" DROP CONSTRAINT "messages_room_id_fkey";
+ALTER TABLE "messages" ADD FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON DELETE CASCADE;
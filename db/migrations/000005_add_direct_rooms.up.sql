@@ -0,0 +1,17 @@
+ALTER TABLE "rooms" ADD COLUMN "kind" varchar NOT NULL DEFAULT 'room';
+
+-- Личная переписка двух пользователей. Пара хранится упорядоченной (user1_id < user2_id),
+-- чтобы у каждой пары была ровно одна комната.
+CREATE TABLE "direct_rooms" (
+    "room_id" bigint PRIMARY KEY,
+    "user1_id" bigint NOT NULL,
+    "user2_id" bigint NOT NULL,
+    CHECK ("user1_id" < "user2_id"),
+    UNIQUE ("user1_id", "user2_id")
+);
+
+ALTER TABLE "direct_rooms" ADD FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON DELETE CASCADE;
+ALTER TABLE "direct_rooms" ADD FOREIGN KEY ("user1_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+ALTER TABLE "direct_rooms" ADD FOREIGN KEY ("user2_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+
+CREATE INDEX ON "direct_rooms" ("user2_id");
@@ -0,0 +1,2 @@
+ALTER TABLE "messages" DROP COLUMN IF EXISTS "deleted_at";
+ALTER TABLE "messages" DROP COLUMN IF EXISTS "edited_at";
@@ -0,0 +1,3 @@
+ALTER TABLE "messages" DROP COLUMN IF EXISTS "last_reply_at";
+ALTER TABLE "messages" DROP COLUMN IF EXISTS "reply_count";
+ALTER TABLE "messages" DROP COLUMN IF EXISTS "parent_id";
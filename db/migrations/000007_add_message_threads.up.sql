@@ -0,0 +1,7 @@
+ALTER TABLE "messages" ADD COLUMN "parent_id" bigint;
+ALTER TABLE "messages" ADD COLUMN "reply_count" integer NOT NULL DEFAULT 0;
+ALTER TABLE "messages" ADD COLUMN "last_reply_at" timestamptz;
+
+ALTER TABLE "messages" ADD FOREIGN KEY ("parent_id") REFERENCES "messages" ("id") ON DELETE CASCADE;
+
+CREATE INDEX ON "messages" ("parent_id", "id");
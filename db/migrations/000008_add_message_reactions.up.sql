@@ -0,0 +1,10 @@
+CREATE TABLE "message_reactions" (
+    "message_id" bigint NOT NULL,
+    "user_id" bigint NOT NULL,
+    "emoji" varchar NOT NULL,
+    "created_at" timestamptz NOT NULL DEFAULT (now()),
+    PRIMARY KEY ("message_id", "user_id", "emoji")
+);
+
+ALTER TABLE "message_reactions" ADD FOREIGN KEY ("message_id") REFERENCES "messages" ("id") ON DELETE CASCADE;
+ALTER TABLE "message_reactions" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
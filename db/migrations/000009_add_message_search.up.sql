@@ -0,0 +1,6 @@
+-- Конфигурация 'simple' не зависит от языка: в чате смешаны русский и английский,
+-- а стемминг одного языка портит поиск по другому.
+ALTER TABLE "messages" ADD COLUMN "search_vector" tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', "content")) STORED;
+
+CREATE INDEX "messages_search_vector_idx" ON "messages" USING GIN ("search_vector");
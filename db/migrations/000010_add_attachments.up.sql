@@ -0,0 +1,18 @@
+CREATE TABLE "attachments" (
+    "id" bigserial PRIMARY KEY,
+    "room_id" bigint NOT NULL,
+    "user_id" bigint NOT NULL,
+    -- Пуст, пока файл загружен, но еще не прикреплен к сообщению.
+    "message_id" bigint,
+    "storage_key" varchar NOT NULL UNIQUE,
+    "filename" varchar NOT NULL,
+    "content_type" varchar NOT NULL,
+    "size" bigint NOT NULL,
+    "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+ALTER TABLE "attachments" ADD FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON DELETE CASCADE;
+ALTER TABLE "attachments" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+ALTER TABLE "attachments" ADD FOREIGN KEY ("message_id") REFERENCES "messages" ("id") ON DELETE CASCADE;
+
+CREATE INDEX ON "attachments" ("message_id");
@@ -0,0 +1,20 @@
+-- Кэш метаданных страниц по URL, общий для всех сообщений.
+CREATE TABLE "link_previews" (
+    "url" varchar PRIMARY KEY,
+    "title" varchar NOT NULL DEFAULT '',
+    "description" varchar NOT NULL DEFAULT '',
+    "image_url" varchar NOT NULL DEFAULT '',
+    "site_name" varchar NOT NULL DEFAULT '',
+    "fetched_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "message_link_previews" (
+    "message_id" bigint NOT NULL,
+    "url" varchar NOT NULL,
+    -- Порядок ссылки в тексте сообщения.
+    "position" int NOT NULL,
+    PRIMARY KEY ("message_id", "url")
+);
+
+ALTER TABLE "message_link_previews" ADD FOREIGN KEY ("message_id") REFERENCES "messages" ("id") ON DELETE CASCADE;
+ALTER TABLE "message_link_previews" ADD FOREIGN KEY ("url") REFERENCES "link_previews" ("url") ON DELETE CASCADE;
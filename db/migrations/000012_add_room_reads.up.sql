@@ -0,0 +1,10 @@
+CREATE TABLE "room_reads" (
+    "room_id" bigint NOT NULL,
+    "user_id" bigint NOT NULL,
+    "last_read_message_id" bigint NOT NULL,
+    "updated_at" timestamptz NOT NULL DEFAULT (now()),
+    PRIMARY KEY ("room_id", "user_id")
+);
+
+ALTER TABLE "room_reads" ADD FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON DELETE CASCADE;
+ALTER TABLE "room_reads" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
@@ -0,0 +1 @@
+ALTER TABLE "rooms" ADD COLUMN "read_receipts" boolean NOT NULL DEFAULT true;
@@ -0,0 +1,25 @@
+-- Сессия - один вход пользователя. Все refresh-токены сессии образуют одну цепочку
+-- ротации, и при повторном использовании любого из них отзывается вся сессия.
+CREATE TABLE "sessions" (
+    "id" bigserial PRIMARY KEY,
+    "user_id" bigint NOT NULL,
+    "created_at" timestamptz NOT NULL DEFAULT (now()),
+    "revoked_at" timestamptz
+);
+
+CREATE TABLE "refresh_tokens" (
+    "id" bigserial PRIMARY KEY,
+    "session_id" bigint NOT NULL,
+    -- SHA-256 от токена: сам токен на сервере не хранится.
+    "token_hash" bytea NOT NULL UNIQUE,
+    "created_at" timestamptz NOT NULL DEFAULT (now()),
+    "expires_at" timestamptz NOT NULL,
+    -- Момент ротации. Повторное предъявление использованного токена означает его кражу.
+    "used_at" timestamptz
+);
+
+ALTER TABLE "sessions" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+ALTER TABLE "refresh_tokens" ADD FOREIGN KEY ("session_id") REFERENCES "sessions" ("id") ON DELETE CASCADE;
+
+CREATE INDEX ON "sessions" ("user_id");
+CREATE INDEX ON "refresh_tokens" ("session_id");
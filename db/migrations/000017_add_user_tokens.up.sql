@@ -0,0 +1,17 @@
+ALTER TABLE "users" ADD COLUMN "email_verified_at" timestamptz;
+
+-- Одноразовые токены из писем: подтверждение адреса и сброс пароля.
+CREATE TABLE "user_tokens" (
+    "id" bigserial PRIMARY KEY,
+    "user_id" bigint NOT NULL,
+    "purpose" varchar NOT NULL,
+    -- SHA-256 от токена: сам токен есть только в письме.
+    "token_hash" bytea NOT NULL UNIQUE,
+    "created_at" timestamptz NOT NULL DEFAULT (now()),
+    "expires_at" timestamptz NOT NULL,
+    "used_at" timestamptz
+);
+
+ALTER TABLE "user_tokens" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+
+CREATE INDEX ON "user_tokens" ("user_id", "purpose");
@@ -0,0 +1,35 @@
+-- TOTP-секрет пользователя. Пока confirmed_at пуст, подключение не завершено
+-- и при входе код не запрашивается.
+CREATE TABLE "user_totp" (
+    "user_id" bigint PRIMARY KEY,
+    "secret" bytea NOT NULL,
+    -- Шаг времени последнего принятого кода: один код нельзя использовать дважды.
+    "last_used_step" bigint NOT NULL DEFAULT 0,
+    "created_at" timestamptz NOT NULL DEFAULT (now()),
+    "confirmed_at" timestamptz
+);
+
+CREATE TABLE "recovery_codes" (
+    "id" bigserial PRIMARY KEY,
+    "user_id" bigint NOT NULL,
+    "code_hash" bytea NOT NULL UNIQUE,
+    "used_at" timestamptz
+);
+
+-- Вход, ожидающий второго фактора. Выдается после проверки пароля.
+CREATE TABLE "mfa_challenges" (
+    "id" bigserial PRIMARY KEY,
+    "user_id" bigint NOT NULL,
+    "token_hash" bytea NOT NULL UNIQUE,
+    "attempts" int NOT NULL DEFAULT 0,
+    "created_at" timestamptz NOT NULL DEFAULT (now()),
+    "expires_at" timestamptz NOT NULL,
+    "used_at" timestamptz
+);
+
+ALTER TABLE "user_totp" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+ALTER TABLE "recovery_codes" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+ALTER TABLE "mfa_challenges" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+
+CREATE INDEX ON "recovery_codes" ("user_id");
+CREATE INDEX ON "mfa_challenges" ("user_id");
@@ -0,0 +1,26 @@
+-- Счетчики неудачных входов по адресу почты и по IP. Ключ - "email:<адрес>" или "ip:<адрес>".
+-- Счетчик по почте ведется и для незарегистрированных адресов, чтобы блокировка
+-- не выдавала, существует ли аккаунт.
+CREATE TABLE "login_throttles" (
+    "key" varchar PRIMARY KEY,
+    "failures" int NOT NULL DEFAULT 0,
+    "last_failed_at" timestamptz NOT NULL DEFAULT (now()),
+    "locked_until" timestamptz
+);
+
+-- Журнал неудачных входов.
+CREATE TABLE "failed_logins" (
+    "id" bigserial PRIMARY KEY,
+    "email" varchar NOT NULL,
+    -- Пуст, если адрес не зарегистрирован.
+    "user_id" bigint,
+    "ip" varchar NOT NULL DEFAULT '',
+    "user_agent" varchar NOT NULL DEFAULT '',
+    "reason" varchar NOT NULL,
+    "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+ALTER TABLE "failed_logins" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE SET NULL;
+
+CREATE INDEX ON "failed_logins" ("user_id", "created_at");
+CREATE INDEX ON "failed_logins" ("ip", "created_at");
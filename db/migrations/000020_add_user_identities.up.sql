@@ -0,0 +1,22 @@
+-- Учетные записи у внешних провайдеров (OpenID Connect), привязанные к пользователям.
+CREATE TABLE "user_identities" (
+    "id" bigserial PRIMARY KEY,
+    "user_id" bigint NOT NULL,
+    "issuer" varchar NOT NULL,
+    "subject" varchar NOT NULL,
+    "created_at" timestamptz NOT NULL DEFAULT (now()),
+    UNIQUE ("issuer", "subject")
+);
+
+-- Начатые входы через провайдера: state из ссылки и связанные с ним nonce и code_verifier.
+CREATE TABLE "oidc_logins" (
+    "state_hash" bytea PRIMARY KEY,
+    "nonce" varchar NOT NULL,
+    "code_verifier" varchar NOT NULL,
+    "created_at" timestamptz NOT NULL DEFAULT (now()),
+    "expires_at" timestamptz NOT NULL
+);
+
+ALTER TABLE "user_identities" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+
+CREATE INDEX ON "user_identities" ("user_id");
@@ -0,0 +1,9 @@
+-- События, не поместившиеся в полезную нагрузку NOTIFY. Уведомление несет только ID записи,
+-- а экземпляры читают само событие отсюда.
+CREATE TABLE "event_outbox" (
+    "id" bigserial PRIMARY KEY,
+    "payload" text NOT NULL,
+    "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "event_outbox" ("created_at");
@@ -0,0 +1,34 @@
+-- Исключенные из комнаты пользователи. Пока запись существует, пользователь не может
+-- снова вступить в публичную комнату и писать в нее.
+CREATE TABLE "room_bans" (
+    "room_id" bigint NOT NULL,
+    "user_id" bigint NOT NULL,
+    "banned_by" bigint,
+    "created_at" timestamptz NOT NULL DEFAULT (now()),
+    PRIMARY KEY ("room_id", "user_id")
+);
+
+ALTER TABLE "room_bans" ADD FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON DELETE CASCADE;
+ALTER TABLE "room_bans" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+ALTER TABLE "room_bans" ADD FOREIGN KEY ("banned_by") REFERENCES "users" ("id") ON DELETE SET NULL;
+
+-- Комнаты, созданные до появления ролей, остались без владельца, и управлять ими некому.
+-- Создатель комнаты нигде не сохранялся, поэтому владельцем становится автор первого
+-- сообщения, а если сообщений нет - участник, вступивший первым.
+WITH candidates AS (
+    SELECT r.id AS room_id,
+           COALESCE(
+               (SELECT m.user_id FROM messages m WHERE m.room_id = r.id ORDER BY m.id LIMIT 1),
+               (SELECT rm.user_id FROM room_members rm WHERE rm.room_id = r.id ORDER BY rm.joined_at, rm.user_id LIMIT 1)
+           ) AS user_id
+    FROM rooms r
+    WHERE r.owner_id IS NULL AND r.kind = 'room'
+), owned AS (
+    UPDATE rooms SET owner_id = candidates.user_id
+    FROM candidates
+    WHERE rooms.id = candidates.room_id AND candidates.user_id IS NOT NULL
+    RETURNING rooms.id, rooms.owner_id
+)
+INSERT INTO room_members (room_id, user_id, role)
+SELECT id, owner_id, 'owner' FROM owned
+ON CONFLICT (room_id, user_id) DO UPDATE SET role = 'owner';
@@ -0,0 +1 @@
+-- Пересчет счетчиков необратим и не требует отката.
@@ -0,0 +1,5 @@
+-- Удаленные ответы раньше оставались в счетчике ветки. Пересчитываем по живым ответам.
+UPDATE messages p
+SET reply_count = (SELECT COUNT(*) FROM messages m WHERE m.parent_id = p.id AND m.deleted_at IS NULL),
+    last_reply_at = (SELECT MAX(m.created_at) FROM messages m WHERE m.parent_id = p.id AND m.deleted_at IS NULL)
+WHERE p.reply_count > 0;
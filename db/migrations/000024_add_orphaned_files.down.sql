@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS attachments_queue_orphaned_file ON attachments;
+DROP FUNCTION IF EXISTS queue_orphaned_file();
+DROP INDEX IF EXISTS "attachments_created_at_idx";
+DROP TABLE IF EXISTS "orphaned_files";
@@ -0,0 +1,25 @@
+-- Файлы в хранилище, у которых больше нет записи в attachments: вложения удаленных
+-- сообщений, комнат и пользователей, а также так и не прикрепленные загрузки.
+-- Фоновая очистка удаляет их из хранилища и затем из этой таблицы.
+CREATE TABLE "orphaned_files" (
+    "storage_key" varchar PRIMARY KEY,
+    "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+-- Триггер срабатывает и при каскадном удалении, поэтому ни один файл не теряется.
+CREATE FUNCTION queue_orphaned_file() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO orphaned_files (storage_key) VALUES (OLD.storage_key) ON CONFLICT DO NOTHING;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER attachments_queue_orphaned_file
+    AFTER DELETE ON attachments
+    FOR EACH ROW EXECUTE FUNCTION queue_orphaned_file();
+
+CREATE INDEX ON "attachments" ("created_at") WHERE "message_id" IS NULL;
+
+-- Вложения уже удаленных сообщений больше не должны отдаваться.
+DELETE FROM attachments a USING messages m
+WHERE a.message_id = m.id AND m.deleted_at IS NOT NULL;
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"errors"
+	"go-chat/internal/auth"
+	"go-chat/internal/repository"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AccountHandler подтверждает почту и восстанавливает доступ по ссылкам из писем.
+type AccountHandler struct {
+	userRepo repository.UserRepository
+	accounts *auth.AccountService
+}
+
+func NewAccountHandler(userRepo repository.UserRepository, accounts *auth.AccountService) *AccountHandler {
+	return &AccountHandler{userRepo: userRepo, accounts: accounts}
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ForgotPassword отправляет письмо для сброса пароля. Ответ одинаков для
+// зарегистрированных и неизвестных адресов.
+func (h *AccountHandler) ForgotPassword(c echo.Context) error {
+	req := new(ForgotPasswordRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	h.accounts.RequestPasswordReset(req.Email)
+
+	return c.JSON(http.StatusAccepted, map[string]string{
+		"message": "If this email is registered, a password reset link has been sent",
+	})
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6"`
+}
+
+// ResetPassword задает новый пароль по токену из письма и завершает все сессии пользователя.
+func (h *AccountHandler) ResetPassword(c echo.Context) error {
+	req := new(ResetPasswordRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := h.accounts.ResetPassword(c.Request().Context(), req.Token, req.Password); err != nil {
+		if errors.Is(err, repository.ErrUserTokenInvalid) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid or expired token"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to reset password"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// VerifyEmail подтверждает адрес по токену из письма.
+func (h *AccountHandler) VerifyEmail(c echo.Context) error {
+	req := new(VerifyEmailRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := h.accounts.VerifyEmail(c.Request().Context(), req.Token); err != nil {
+		if errors.Is(err, repository.ErrUserTokenInvalid) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid or expired token"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to verify email"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ResendVerification повторно отправляет текущему пользователю письмо для подтверждения адреса.
+func (h *AccountHandler) ResendVerification(c echo.Context) error {
+	ctx := c.Request().Context()
+	user, err := h.userRepo.GetByID(ctx, userClaims(c).UserID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch user"})
+	}
+
+	if err := h.accounts.SendVerification(ctx, user); err != nil {
+		if errors.Is(err, auth.ErrEmailAlreadyVerified) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Email address is already verified"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to send verification email"})
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go-chat/internal/domain"
+	"go-chat/internal/repository"
+	"go-chat/internal/storage"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Запас на заголовки multipart сверх размера самого файла.
+const multipartOverhead = 1 << 20
+
+type AttachmentHandler struct {
+	roomRepo       repository.RoomRepository
+	attachmentRepo repository.AttachmentRepository
+	storage        storage.Storage
+	maxSize        int64
+	allowedTypes   []string
+	posting        *PostingPolicy
+}
+
+func NewAttachmentHandler(roomRepo repository.RoomRepository, attachmentRepo repository.AttachmentRepository, storage storage.Storage, maxSize int64, allowedTypes []string, posting *PostingPolicy) *AttachmentHandler {
+	return &AttachmentHandler{
+		roomRepo:       roomRepo,
+		attachmentRepo: attachmentRepo,
+		storage:        storage,
+		maxSize:        maxSize,
+		allowedTypes:   allowedTypes,
+		posting:        posting,
+	}
+}
+
+// Upload обрабатывает загрузку файла в комнату (multipart, поле "file").
+// Загруженный файл прикрепляется к сообщению через attachment_ids в PostMessage.
+func (h *AttachmentHandler) Upload(c echo.Context) error {
+	roomID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	ctx := c.Request().Context()
+	userID := userClaims(c).UserID
+	if _, err := requireRoomPermission(ctx, h.roomRepo, roomID, userID, domain.PermPostMessage); err != nil {
+		return roomAccessError(c, err)
+	}
+	if err := h.posting.check(ctx, userID); err != nil {
+		return roomAccessError(c, err)
+	}
+
+	// Не даем клиенту записать во временные файлы больше, чем разрешено.
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, h.maxSize+multipartOverhead)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "File is too large"})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "File is required"})
+	}
+	if fileHeader.Size > h.maxSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "File is too large"})
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Failed to read file"})
+	}
+	defer file.Close()
+
+	contentType, err := detectContentType(file)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Failed to read file"})
+	}
+	if !slices.Contains(h.allowedTypes, contentType) {
+		return c.JSON(http.StatusUnsupportedMediaType, map[string]string{"error": "File type is not allowed"})
+	}
+
+	key, err := newStorageKey(roomID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to store file"})
+	}
+	if err := h.storage.Put(ctx, key, file, fileHeader.Size, contentType); err != nil {
+		log.Printf("failed to store attachment: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to store file"})
+	}
+
+	attachment := &domain.Attachment{
+		RoomID:      roomID,
+		UserID:      userID,
+		StorageKey:  key,
+		Filename:    sanitizeFilename(fileHeader.Filename),
+		ContentType: contentType,
+		Size:        fileHeader.Size,
+	}
+	if err := h.attachmentRepo.Create(ctx, attachment); err != nil {
+		if err := h.storage.Delete(ctx, key); err != nil {
+			log.Printf("failed to delete orphaned attachment %s: %v", key, err)
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to store file"})
+	}
+
+	return c.JSON(http.StatusCreated, attachment)
+}
+
+// Download обрабатывает скачивание вложения участником комнаты, в которую оно загружено.
+// Еще не прикрепленное к сообщению вложение доступно только загрузившему его.
+func (h *AttachmentHandler) Download(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid attachment ID"})
+	}
+
+	ctx := c.Request().Context()
+	userID := userClaims(c).UserID
+	notFound := func() error {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Attachment not found"})
+	}
+
+	attachment, err := h.attachmentRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrAttachmentNotFound) {
+			return notFound()
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch attachment"})
+	}
+
+	if _, err := checkRoomAccess(ctx, h.roomRepo, attachment.RoomID, userID); err != nil {
+		if errors.Is(err, repository.ErrRoomNotFound) {
+			return notFound()
+		}
+		return roomAccessError(c, err)
+	}
+	if attachment.MessageID == nil && attachment.UserID != userID {
+		return notFound()
+	}
+
+	body, err := h.storage.Get(ctx, attachment.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return notFound()
+		}
+		log.Printf("failed to read attachment %d: %v", attachment.ID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to read attachment"})
+	}
+	defer body.Close()
+
+	// Изображения показываются в браузере, остальное только скачивается. Вдобавок
+	// запрещаем браузеру угадывать тип и исполнять что-либо из ответа.
+	disposition := "attachment"
+	if isInlineImage(attachment.ContentType) {
+		disposition = "inline"
+	}
+	header := c.Response().Header()
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+	header.Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Content-Security-Policy", "sandbox")
+
+	return c.Stream(http.StatusOK, attachment.ContentType, body)
+}
+
+// detectContentType определяет MIME-тип по первым байтам файла и возвращает
+// позицию чтения в начало.
+func detectContentType(file io.ReadSeeker) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	contentType, _, err := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	if err != nil {
+		return "", err
+	}
+	return contentType, nil
+}
+
+func isInlineImage(contentType string) bool {
+	// SVG может содержать скрипты, поэтому всегда отдается как файл.
+	return strings.HasPrefix(contentType, "image/") && contentType != "image/svg+xml"
+}
+
+// newStorageKey генерирует случайный ключ объекта в хранилище.
+func newStorageKey(roomID int64) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("rooms/%d/%s", roomID, hex.EncodeToString(b)), nil
+}
+
+// sanitizeFilename оставляет от имени файла клиента только последний элемент пути.
+func sanitizeFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == "" {
+		return "file"
+	}
+	if runes := []rune(name); len(runes) > 255 {
+		name = string(runes[:255])
+	}
+	return name
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"errors"
+	"go-chat/internal/repository"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// DirectMessageHandler обрабатывает личные переписки. Переписка - это приватная комната
+// из двух участников, поэтому сообщения в ней отправляются и читаются через обычные
+// маршруты комнат, включая WebSocket.
+type DirectMessageHandler struct {
+	roomRepo repository.RoomRepository
+	userRepo repository.UserRepository
+}
+
+func NewDirectMessageHandler(roomRepo repository.RoomRepository, userRepo repository.UserRepository) *DirectMessageHandler {
+	return &DirectMessageHandler{roomRepo: roomRepo, userRepo: userRepo}
+}
+
+// OpenConversation находит или создает личную переписку с пользователем.
+func (h *DirectMessageHandler) OpenConversation(c echo.Context) error {
+	otherUserID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+	}
+
+	userID := userClaims(c).UserID
+	if otherUserID == userID {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Cannot start a conversation with yourself"})
+	}
+
+	if _, err := h.userRepo.GetByID(c.Request().Context(), otherUserID); err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch user"})
+	}
+
+	room, created, err := h.roomRepo.FindOrCreateDirectRoom(c.Request().Context(), userID, otherUserID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to open conversation"})
+	}
+
+	if created {
+		return c.JSON(http.StatusCreated, room)
+	}
+	return c.JSON(http.StatusOK, room)
+}
+
+// GetConversations обрабатывает получение личных переписок текущего пользователя.
+func (h *DirectMessageHandler) GetConversations(c echo.Context) error {
+	conversations, err := h.roomRepo.GetDirectConversations(c.Request().Context(), userClaims(c).UserID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch conversations"})
+	}
+
+	return c.JSON(http.StatusOK, conversations)
+}
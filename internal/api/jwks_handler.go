@@ -0,0 +1,24 @@
+package api
+
+import (
+	"go-chat/internal/auth"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// JWKSHandler публикует открытые ключи, которыми другие сервисы проверяют access-токены чата.
+type JWKSHandler struct {
+	keys *auth.KeyRing
+}
+
+func NewJWKSHandler(keys *auth.KeyRing) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// GetJWKS возвращает набор ключей в формате RFC 7517. Новый ключ появляется здесь
+// раньше, чем начинает подписывать токены, так что короткого кэширования достаточно.
+func (h *JWKSHandler) GetJWKS(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, map[string][]auth.JWK{"keys": h.keys.JWKS()})
+}
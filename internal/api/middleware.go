@@ -1,7 +1,7 @@
 package api
 
 import (
-	"go-chat/internal/config"
+	"go-chat/internal/auth"
 	"go-chat/internal/domain"
 	"net/http"
 
@@ -10,12 +10,13 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-func JWTMiddleware(cfg *config.Config) echo.MiddlewareFunc {
+// JWTMiddleware проверяет access-токен и то, что его сессия не отозвана.
+func JWTMiddleware(authService *auth.Service) echo.MiddlewareFunc {
 	config := echojwt.Config{
-		NewClaimsFunc: func(c echo.Context) jwt.Claims {
-			return new(domain.JWTCustomClaims)
+		// Ключи подписи хранит auth.Service, он же и проверяет токены.
+		ParseTokenFunc: func(c echo.Context, auth string) (interface{}, error) {
+			return authService.ParseAccessToken(auth)
 		},
-		SigningKey:  []byte(cfg.JWTSecret),
 		TokenLookup: "header:Authorization:Bearer ,query:token", // Искать токен в заголовке и в query-параметре "token" для WebSocket
 		ErrorHandler: func(c echo.Context, err error) error {
 			c.Logger().Errorf("JWT validation error: %v", err)
@@ -24,5 +25,23 @@ func JWTMiddleware(cfg *config.Config) echo.MiddlewareFunc {
 			})
 		},
 	}
-	return echojwt.WithConfig(config)
+	jwtMiddleware := echojwt.WithConfig(config)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return jwtMiddleware(func(c echo.Context) error {
+			active, err := authService.CheckSession(c.Request().Context(), userClaims(c).SessionID)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check session"})
+			}
+			if !active {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "session has been revoked"})
+			}
+			return next(c)
+		})
+	}
+}
+
+// userClaims возвращает claims пользователя, проверенные JWTMiddleware.
+func userClaims(c echo.Context) *domain.JWTCustomClaims {
+	return c.Get("user").(*jwt.Token).Claims.(*domain.JWTCustomClaims)
 }
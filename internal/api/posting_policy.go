@@ -0,0 +1,36 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"go-chat/internal/repository"
+)
+
+// errEmailNotVerified означает, что писать сообщения можно только после подтверждения почты.
+var errEmailNotVerified = errors.New("email not verified")
+
+// PostingPolicy - ограничения на отправку сообщений, не зависящие от комнаты.
+type PostingPolicy struct {
+	users                repository.UserRepository
+	requireVerifiedEmail bool
+}
+
+func NewPostingPolicy(users repository.UserRepository, requireVerifiedEmail bool) *PostingPolicy {
+	return &PostingPolicy{users: users, requireVerifiedEmail: requireVerifiedEmail}
+}
+
+// check проверяет, может ли пользователь писать сообщения. Статус почты читается из БД,
+// а не из JWT, чтобы подтверждение действовало сразу, без обновления токена.
+func (p *PostingPolicy) check(ctx context.Context, userID int64) error {
+	if p == nil || !p.requireVerifiedEmail {
+		return nil
+	}
+	user, err := p.users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.IsEmailVerified() {
+		return errEmailNotVerified
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"errors"
+	"go-chat/internal/domain"
+	"go-chat/internal/repository"
+	"go-chat/internal/websocket"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// PresenceHandler отдает сетевой статус пользователей. Статус известен по открытым
+// WebSocket-соединениям того экземпляра сервиса, который обрабатывает запрос.
+type PresenceHandler struct {
+	roomRepo   repository.RoomRepository
+	userRepo   repository.UserRepository
+	hubManager *websocket.HubManager
+}
+
+func NewPresenceHandler(roomRepo repository.RoomRepository, userRepo repository.UserRepository, hubManager *websocket.HubManager) *PresenceHandler {
+	return &PresenceHandler{roomRepo: roomRepo, userRepo: userRepo, hubManager: hubManager}
+}
+
+// GetRoomPresence обрабатывает получение списка пользователей в сети в комнате.
+func (h *PresenceHandler) GetRoomPresence(c echo.Context) error {
+	roomID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	if _, err := checkRoomAccess(c.Request().Context(), h.roomRepo, roomID, userClaims(c).UserID); err != nil {
+		return roomAccessError(c, err)
+	}
+
+	online := h.hubManager.RoomPresence(roomID)
+	slices.SortFunc(online, func(a, b domain.Presence) int {
+		return strings.Compare(a.Username, b.Username)
+	})
+
+	return c.JSON(http.StatusOK, online)
+}
+
+// GetUserPresence обрабатывает получение статуса пользователя: в сети он
+// или когда был в сети последний раз.
+func (h *PresenceHandler) GetUserPresence(c echo.Context) error {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+	}
+
+	ctx := c.Request().Context()
+	user, err := h.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch user"})
+	}
+
+	presence := &domain.Presence{UserID: user.ID, Username: user.Username, Status: domain.PresenceOnline}
+	if !h.hubManager.IsOnline(user.ID) {
+		presence.Status = domain.PresenceOffline
+		presence.LastSeenAt, err = h.userRepo.GetLastSeen(ctx, user.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch user"})
+		}
+	}
+
+	return c.JSON(http.StatusOK, presence)
+}
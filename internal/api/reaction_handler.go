@@ -0,0 +1,107 @@
+package api
+
+import (
+	"go-chat/internal/domain"
+	"go-chat/internal/repository"
+	"go-chat/internal/websocket"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ReactionHandler struct {
+	roomRepo     repository.RoomRepository
+	reactionRepo repository.ReactionRepository
+	hubManager   *websocket.HubManager
+}
+
+func NewReactionHandler(roomRepo repository.RoomRepository, reactionRepo repository.ReactionRepository, hubManager *websocket.HubManager) *ReactionHandler {
+	return &ReactionHandler{roomRepo: roomRepo, reactionRepo: reactionRepo, hubManager: hubManager}
+}
+
+type ReactionRequest struct {
+	// Длина ограничена с запасом: самые длинные ZWJ-последовательности занимают 35 байт.
+	Emoji string `json:"emoji" validate:"required,max=64,emoji"`
+}
+
+// AddReaction обрабатывает добавление реакции текущего пользователя на сообщение.
+func (h *ReactionHandler) AddReaction(c echo.Context) error {
+	req := new(ReactionRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	return h.updateReaction(c, req, domain.EventReactionAdded)
+}
+
+// RemoveReaction обрабатывает снятие реакции текущего пользователя с сообщения.
+// Эмодзи передается в пути запроса в URL-кодировке.
+func (h *ReactionHandler) RemoveReaction(c echo.Context) error {
+	emoji, err := url.PathUnescape(c.Param("emoji"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid emoji"})
+	}
+
+	return h.updateReaction(c, &ReactionRequest{Emoji: emoji}, domain.EventReactionRemoved)
+}
+
+// updateReaction проверяет доступ к сообщению, добавляет или снимает реакцию
+// и рассылает изменение подписчикам комнаты.
+func (h *ReactionHandler) updateReaction(c echo.Context, req *ReactionRequest, eventType domain.EventType) error {
+	roomID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	messageID, err := strconv.ParseInt(c.Param("msg_id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid message ID"})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	ctx := c.Request().Context()
+	userID := userClaims(c).UserID
+	if _, err := requireRoomPermission(ctx, h.roomRepo, roomID, userID, domain.PermPostMessage); err != nil {
+		return roomAccessError(c, err)
+	}
+
+	message, err := h.roomRepo.GetMessage(ctx, roomID, messageID)
+	if err != nil {
+		return messageError(c, err)
+	}
+	if message.IsDeleted() {
+		return messageError(c, repository.ErrMessageNotFound)
+	}
+
+	var (
+		count   int
+		changed bool
+	)
+	if eventType == domain.EventReactionAdded {
+		count, changed, err = h.reactionRepo.AddReaction(ctx, messageID, userID, req.Emoji)
+	} else {
+		count, changed, err = h.reactionRepo.RemoveReaction(ctx, messageID, userID, req.Emoji)
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update reaction"})
+	}
+
+	update := &domain.ReactionUpdate{
+		MessageID: messageID,
+		RoomID:    roomID,
+		UserID:    userID,
+		Emoji:     req.Emoji,
+		Count:     count,
+	}
+	// Повторная реакция или снятие несуществующей ничего не меняют, и рассылать нечего.
+	if changed {
+		broadcastEvent(ctx, h.hubManager, roomID, domain.NewEvent(eventType, update))
+	}
+
+	return c.JSON(http.StatusOK, update)
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"go-chat/internal/domain"
+	"go-chat/internal/repository"
+	"go-chat/internal/websocket"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ReadHandler struct {
+	roomRepo   repository.RoomRepository
+	readRepo   repository.ReadRepository
+	hubManager *websocket.HubManager
+}
+
+func NewReadHandler(roomRepo repository.RoomRepository, readRepo repository.ReadRepository, hubManager *websocket.HubManager) *ReadHandler {
+	return &ReadHandler{roomRepo: roomRepo, readRepo: readRepo, hubManager: hubManager}
+}
+
+type MarkReadRequest struct {
+	MessageID int64 `json:"message_id" validate:"required,gt=0"`
+}
+
+// MarkRead обрабатывает продвижение отметки прочтения комнаты текущим пользователем.
+func (h *ReadHandler) MarkRead(c echo.Context) error {
+	roomID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	req := new(MarkReadRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	ctx := c.Request().Context()
+	claims := userClaims(c)
+	access, err := checkRoomAccess(ctx, h.roomRepo, roomID, claims.UserID)
+	if err != nil {
+		return roomAccessError(c, err)
+	}
+
+	marker, err := markRead(ctx, h.readRepo, h.hubManager, access, claims.UserID, claims.Username, req.MessageID)
+	if err != nil {
+		if errors.Is(err, repository.ErrMessageNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Message not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update read marker"})
+	}
+
+	return c.JSON(http.StatusOK, marker)
+}
+
+// GetReceipts обрабатывает получение позиций прочтения всех участников комнаты.
+func (h *ReadHandler) GetReceipts(c echo.Context) error {
+	roomID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	access, err := checkRoomAccess(c.Request().Context(), h.roomRepo, roomID, userClaims(c).UserID)
+	if err != nil {
+		return roomAccessError(c, err)
+	}
+	if !access.room.ReadReceipts {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Read receipts are disabled in this room"})
+	}
+
+	receipts, err := h.readRepo.GetReceipts(c.Request().Context(), roomID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch read receipts"})
+	}
+
+	return c.JSON(http.StatusOK, receipts)
+}
+
+// GetMessageReaders обрабатывает получение списка участников, прочитавших сообщение.
+func (h *ReadHandler) GetMessageReaders(c echo.Context) error {
+	roomID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	messageID, err := strconv.ParseInt(c.Param("msg_id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid message ID"})
+	}
+
+	ctx := c.Request().Context()
+	access, err := checkRoomAccess(ctx, h.roomRepo, roomID, userClaims(c).UserID)
+	if err != nil {
+		return roomAccessError(c, err)
+	}
+	if !access.room.ReadReceipts {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Read receipts are disabled in this room"})
+	}
+
+	message, err := h.roomRepo.GetMessage(ctx, roomID, messageID)
+	if err != nil {
+		if errors.Is(err, repository.ErrMessageNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Message not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch message"})
+	}
+
+	readers, err := h.readRepo.GetMessageReaders(ctx, message)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch read receipts"})
+	}
+
+	return c.JSON(http.StatusOK, readers)
+}
+
+// markRead продвигает отметку прочтения и сообщает о ней остальным устройствам пользователя,
+// чтобы они сбросили счетчик непрочитанных. Если в комнате включены отметки о прочтении,
+// а пользователь в ней состоит, о продвижении узнают и остальные участники.
+// Используется и REST-обработчиком, и WebSocket-соединением.
+func markRead(ctx context.Context, readRepo repository.ReadRepository, hubManager *websocket.HubManager, access *roomAccess, userID int64, username string, messageID int64) (*domain.ReadMarker, error) {
+	marker, advanced, err := readRepo.MarkRead(ctx, access.room.ID, userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := hubManager.SendToUser(ctx, userID, domain.NewEvent(domain.EventReadUpdated, marker)); err != nil {
+		log.Printf("failed to send %s to user %d: %v", domain.EventReadUpdated, userID, err)
+	}
+
+	if advanced && access.room.ReadReceipts && access.role != "" {
+		receipt := &domain.ReadReceipt{
+			RoomID:            access.room.ID,
+			UserID:            userID,
+			Username:          username,
+			LastReadMessageID: marker.LastReadMessageID,
+			ReadAt:            time.Now(),
+		}
+		broadcastEvent(ctx, hubManager, access.room.ID, domain.NewEvent(domain.EventReceiptUpdated, receipt))
+	}
+
+	return marker, nil
+}
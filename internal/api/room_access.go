@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"go-chat/internal/domain"
+	"go-chat/internal/repository"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	// errForbidden означает, что роли пользователя недостаточно для действия.
+	errForbidden = errors.New("forbidden")
+	// errBanned означает, что пользователя исключили из комнаты и доступ к ней закрыт.
+	errBanned = errors.New("banned from room")
+)
+
+// roomAccess - комната и роль текущего пользователя в ней.
+type roomAccess struct {
+	room *domain.Room
+	// role пуста, если пользователь не состоит в комнате.
+	role domain.Role
+}
+
+// can сообщает, разрешено ли пользователю действие в комнате.
+func (a *roomAccess) can(p domain.Permission) bool {
+	// Публичные комнаты открыты для сообщений и тем, кто в них не вступил.
+	// Исключенные сюда не доходят: им отказывает checkRoomAccess.
+	if p == domain.PermPostMessage && !a.room.IsPrivate() {
+		return true
+	}
+	return a.role.Can(p)
+}
+
+// checkRoomAccess проверяет, что пользователь может читать комнату, и возвращает его роль.
+// Для приватной комнаты, в которой пользователь не состоит, возвращает
+// repository.ErrRoomNotFound, чтобы не раскрывать ее существование, а для исключенного
+// пользователя - errBanned: он не может ни читать комнату, ни писать в нее, ни подключиться.
+func checkRoomAccess(ctx context.Context, roomRepo repository.RoomRepository, roomID, userID int64) (*roomAccess, error) {
+	room, err := roomRepo.GetRoom(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := roomRepo.GetMemberRole(ctx, roomID, userID)
+	if err != nil && !errors.Is(err, repository.ErrNotMember) {
+		return nil, err
+	}
+	if role == "" && room.IsPrivate() {
+		return nil, repository.ErrRoomNotFound
+	}
+
+	// Исключение снимает членство, а AddMember снимает запрет,
+	// поэтому проверять запрет нужно только у не-участников.
+	if role == "" {
+		banned, err := roomRepo.IsBanned(ctx, roomID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if banned {
+			return nil, errBanned
+		}
+	}
+	return &roomAccess{room: room, role: role}, nil
+}
+
+// requireRoomPermission проверяет доступ к комнате и право на действие.
+// Если права нет, возвращает errForbidden.
+func requireRoomPermission(ctx context.Context, roomRepo repository.RoomRepository, roomID, userID int64, p domain.Permission) (*roomAccess, error) {
+	access, err := checkRoomAccess(ctx, roomRepo, roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !access.can(p) {
+		return nil, errForbidden
+	}
+	return access, nil
+}
+
+// roomAccessError преобразует ошибку проверки доступа в HTTP-ответ.
+func roomAccessError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, repository.ErrRoomNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Room not found"})
+	case errors.Is(err, errForbidden):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Insufficient permissions"})
+	case errors.Is(err, errBanned):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "You are banned from this room"})
+	case errors.Is(err, errEmailNotVerified):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Email address is not verified"})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch room"})
+}
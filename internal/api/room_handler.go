@@ -1,27 +1,37 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"go-chat/internal/domain"
 	"go-chat/internal/repository"
+	"go-chat/internal/unfurl"
 	"go-chat/internal/websocket"
+	"log"
 	"net/http"
+	"slices"
 	"strconv"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 )
 
 type RoomHandler struct {
-	roomRepo repository.RoomRepository
+	roomRepo   repository.RoomRepository
 	hubManager *websocket.HubManager
+	unfurler   *unfurl.Worker
+	posting    *PostingPolicy
 }
 
-func NewRoomHandler(roomRepo repository.RoomRepository, hubManager *websocket.HubManager) *RoomHandler {
-	return &RoomHandler{roomRepo: roomRepo, hubManager: hubManager}
+// NewRoomHandler создает обработчик комнат. unfurler может быть nil, если карточки ссылок отключены.
+func NewRoomHandler(roomRepo repository.RoomRepository, hubManager *websocket.HubManager, unfurler *unfurl.Worker, posting *PostingPolicy) *RoomHandler {
+	return &RoomHandler{roomRepo: roomRepo, hubManager: hubManager, unfurler: unfurler, posting: posting}
 }
 
 type CreateRoomRequest struct {
-	Name string `json:"name" validate:"required,min=3,max=50"`
+	Name       string `json:"name" validate:"required,min=3,max=50"`
+	Visibility string `json:"visibility" validate:"omitempty,oneof=public private"`
+	// ReadReceipts по умолчанию включены.
+	ReadReceipts *bool `json:"read_receipts"`
 }
 
 // CreateRoom обрабатывает создание новой комнаты чата.
@@ -36,19 +46,25 @@ func (h *RoomHandler) CreateRoom(c echo.Context) error {
 	}
 
 	room := &domain.Room{
-		Name: req.Name,
+		Name:       req.Name,
+		Visibility: req.Visibility,
 	}
+	if room.Visibility == "" {
+		room.Visibility = domain.RoomPublic
+	}
+	room.ReadReceipts = req.ReadReceipts == nil || *req.ReadReceipts
 
-	if err := h.roomRepo.CreateRoom(c.Request().Context(), room); err != nil {
+	if err := h.roomRepo.CreateRoom(c.Request().Context(), room, userClaims(c).UserID); err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create room"})
 	}
 
 	return c.JSON(http.StatusCreated, room)
 }
 
-// GetRooms обрабатывает получение всех доступных комнат чата.
+// GetRooms обрабатывает получение всех доступных комнат чата:
+// публичных и приватных, в которых состоит пользователь.
 func (h *RoomHandler) GetRooms(c echo.Context) error {
-	rooms, err := h.roomRepo.GetRooms(c.Request().Context())
+	rooms, err := h.roomRepo.GetRooms(c.Request().Context(), userClaims(c).UserID)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch rooms"})
 	}
@@ -56,11 +72,92 @@ func (h *RoomHandler) GetRooms(c echo.Context) error {
 	return c.JSON(http.StatusOK, rooms)
 }
 
+// UpdateRoomRequest - изменяемые настройки комнаты. Незаданные поля не меняются.
+type UpdateRoomRequest struct {
+	Name         string `json:"name" validate:"required_without=ReadReceipts,omitempty,min=3,max=50"`
+	ReadReceipts *bool  `json:"read_receipts"`
+}
+
+// UpdateRoom обрабатывает изменение названия и настроек комнаты. Доступно владельцу и администраторам.
+func (h *RoomHandler) UpdateRoom(c echo.Context) error {
+	roomID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	req := new(UpdateRoomRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	access, err := requireRoomPermission(c.Request().Context(), h.roomRepo, roomID, userClaims(c).UserID, domain.PermUpdateRoom)
+	if err != nil {
+		return roomAccessError(c, err)
+	}
+
+	room := access.room
+	if req.Name != "" {
+		room.Name = req.Name
+	}
+	if req.ReadReceipts != nil {
+		room.ReadReceipts = *req.ReadReceipts
+	}
+	if err := h.roomRepo.UpdateRoom(c.Request().Context(), room); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update room"})
+	}
+
+	broadcastEvent(c.Request().Context(), h.hubManager, roomID, domain.NewEvent(domain.EventRoomUpdated, room))
+
+	return c.JSON(http.StatusOK, room)
+}
+
+// DeleteRoom обрабатывает удаление комнаты. Доступно владельцу и администраторам.
+func (h *RoomHandler) DeleteRoom(c echo.Context) error {
+	roomID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	access, err := requireRoomPermission(c.Request().Context(), h.roomRepo, roomID, userClaims(c).UserID, domain.PermDeleteRoom)
+	if err != nil {
+		return roomAccessError(c, err)
+	}
+
+	if err := h.roomRepo.DeleteRoom(c.Request().Context(), roomID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete room"})
+	}
+
+	// Хабы отключат всех клиентов удаленной комнаты.
+	broadcastEvent(c.Request().Context(), h.hubManager, roomID, domain.NewEvent(domain.EventRoomDeleted, access.room))
+
+	return c.NoContent(http.StatusNoContent)
+}
+
 type PostMessageRequest struct {
-	Content string `json:"content" validate:"required,max=1000"`
+	// Content может быть пустым, только если к сообщению прикреплены файлы.
+	Content string `json:"content" validate:"required_without=AttachmentIDs,max=1000"`
+	// ParentID - сообщение, в ветку которого публикуется ответ.
+	ParentID *int64 `json:"parent_id" validate:"omitempty,gt=0"`
+	// AttachmentIDs - ранее загруженные в комнату файлы, которые прикрепляются к сообщению.
+	AttachmentIDs []int64 `json:"attachment_ids" validate:"omitempty,max=10,dive,gt=0"`
 }
 
-// PostMessage обрабатывает отправку нового сообщения в определенную комнату.
+// normalize убирает повторы из AttachmentIDs, а пустой список заменяет на nil,
+// чтобы сообщение без текста и без вложений не прошло валидацию.
+func (r *PostMessageRequest) normalize() {
+	if len(r.AttachmentIDs) == 0 {
+		r.AttachmentIDs = nil
+		return
+	}
+	slices.Sort(r.AttachmentIDs)
+	r.AttachmentIDs = slices.Compact(r.AttachmentIDs)
+}
+
+// PostMessage обрабатывает отправку нового сообщения (или ответа в ветке) в определенную комнату.
 func (h *RoomHandler) PostMessage(c echo.Context) error {
 	roomID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
@@ -72,48 +169,303 @@ func (h *RoomHandler) PostMessage(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
 	}
 
+	req.normalize()
 	if err := c.Validate(req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
-	userToken := c.Get("user").(*jwt.Token)
-	claims := userToken.Claims.(*domain.JWTCustomClaims)
-	userID := claims.UserID
-	username := claims.Username
+	claims := userClaims(c)
+	if _, err := requireRoomPermission(c.Request().Context(), h.roomRepo, roomID, claims.UserID, domain.PermPostMessage); err != nil {
+		return roomAccessError(c, err)
+	}
+	if err := h.posting.check(c.Request().Context(), claims.UserID); err != nil {
+		return roomAccessError(c, err)
+	}
 
 	message := &domain.Message{
-		RoomID:  roomID,
-		UserID:  userID,
-		Content: req.Content,
+		RoomID:   roomID,
+		UserID:   claims.UserID,
+		Username: claims.Username,
+		Content:  req.Content,
+		ParentID: req.ParentID,
 	}
 
-	if err := h.roomRepo.SaveMessage(c.Request().Context(), message); err != nil {
-		// В будущем здесь можно будет проверить ошибку внешнего ключа, чтобы убедиться, что комната существует.
+	if err := publishMessage(c.Request().Context(), h.roomRepo, h.hubManager, h.unfurler, message, req.AttachmentIDs); err != nil {
+		if errors.Is(err, repository.ErrParentNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Parent message not found"})
+		}
+		if errors.Is(err, repository.ErrAttachmentNotFound) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid attachment"})
+		}
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save message"})
 	}
 
-	// Добавляем имя пользователя в сообщение перед отправкой через WebSocket
-	message.Username = username
+	return c.JSON(http.StatusCreated, message)
+}
 
-	// Находим хаб для этой комнаты и отправляем сообщение, если хаб существует (т.е. есть подписчики)
-	if hub, ok := h.hubManager.GetHub(roomID); ok {
-		hub.Broadcast(message)
+// publishMessage сохраняет сообщение и рассылает его подписчикам комнаты.
+// Используется и REST-обработчиком, и WebSocket-соединением. Карточки ссылок строятся
+// в фоне и приходят позже событием message.updated.
+func publishMessage(ctx context.Context, roomRepo repository.RoomRepository, hubManager *websocket.HubManager, unfurler *unfurl.Worker, message *domain.Message, attachmentIDs []int64) error {
+	if err := roomRepo.SaveMessage(ctx, message, attachmentIDs); err != nil {
+		return err
 	}
 
-	return c.JSON(http.StatusCreated, message)
+	broadcastEvent(ctx, hubManager, message.RoomID, domain.NewEvent(domain.EventMessageCreated, message))
+	unfurler.Enqueue(message)
+
+	if message.ParentID != nil {
+		broadcastThread(ctx, roomRepo, hubManager, message.RoomID, *message.ParentID)
+	}
+
+	return nil
+}
+
+// broadcastThread рассылает новое состояние ветки после добавления или удаления ответа.
+// Ответ к этому моменту уже сохранен, поэтому ошибка чтения ветки только логируется.
+func broadcastThread(ctx context.Context, roomRepo repository.RoomRepository, hubManager *websocket.HubManager, roomID, parentID int64) {
+	parent, err := roomRepo.GetMessage(ctx, roomID, parentID)
+	if err != nil {
+		log.Printf("failed to fetch thread %d: %v", parentID, err)
+		return
+	}
+	thread := &domain.ThreadSummary{
+		MessageID:   parent.ID,
+		RoomID:      parent.RoomID,
+		ReplyCount:  parent.ReplyCount,
+		LastReplyAt: parent.LastReplyAt,
+	}
+	broadcastEvent(ctx, hubManager, roomID, domain.NewEvent(domain.EventThreadUpdated, thread))
 }
 
-// GetMessages обрабатывает получение всех сообщений для определенной комнаты.
+// broadcastEvent рассылает событие подписчикам комнаты. Изменение к этому моменту уже
+// сохранено, поэтому ошибка рассылки только логируется и не приводит к ошибке запроса.
+func broadcastEvent(ctx context.Context, hubManager *websocket.HubManager, roomID int64, event *domain.Event) {
+	if err := hubManager.Broadcast(ctx, roomID, event); err != nil {
+		log.Printf("failed to broadcast %s to room %d: %v", event.Type, roomID, err)
+	}
+}
+
+const (
+	// Размер страницы сообщений по умолчанию.
+	defaultMessagesLimit = 50
+	// Максимальный размер страницы сообщений.
+	maxMessagesLimit = 100
+)
+
+// MessagesPage - страница истории сообщений комнаты.
+type MessagesPage struct {
+	Messages []domain.Message `json:"messages"`
+	// NextCursor - значение для параметра before (или after, если он был задан)
+	// следующего запроса. Равно null, если сообщений больше нет.
+	NextCursor *int64 `json:"next_cursor"`
+}
+
+// GetMessages обрабатывает получение страницы сообщений верхнего уровня для определенной комнаты.
+// Поддерживает курсоры before/after по ID сообщения и параметр limit.
 func (h *RoomHandler) GetMessages(c echo.Context) error {
 	roomID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
 	}
 
-	messages, err := h.roomRepo.GetMessagesByRoomID(c.Request().Context(), roomID)
+	if _, err := checkRoomAccess(c.Request().Context(), h.roomRepo, roomID, userClaims(c).UserID); err != nil {
+		return roomAccessError(c, err)
+	}
+
+	q, err := parseMessageQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	return h.respondMessagesPage(c, roomID, q)
+}
+
+// GetReplies обрабатывает получение страницы ответов в ветке сообщения.
+// Поддерживает те же параметры пагинации, что и GetMessages.
+func (h *RoomHandler) GetReplies(c echo.Context) error {
+	roomID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	messageID, err := strconv.ParseInt(c.Param("msg_id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid message ID"})
+	}
+
+	ctx := c.Request().Context()
+	if _, err := checkRoomAccess(ctx, h.roomRepo, roomID, userClaims(c).UserID); err != nil {
+		return roomAccessError(c, err)
+	}
+
+	if _, err := h.roomRepo.GetMessage(ctx, roomID, messageID); err != nil {
+		return messageError(c, err)
+	}
+
+	q, err := parseMessageQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	q.ParentID = messageID
+
+	return h.respondMessagesPage(c, roomID, q)
+}
+
+// respondMessagesPage отвечает страницей сообщений с курсором следующей страницы.
+func (h *RoomHandler) respondMessagesPage(c echo.Context, roomID int64, q repository.MessageQuery) error {
+	limit := q.Limit
+	// Запрашиваем на одно сообщение больше, чтобы понять, есть ли следующая страница.
+	q.Limit++
+	messages, err := h.roomRepo.GetMessagesByRoomID(c.Request().Context(), roomID, q)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch messages"})
 	}
 
-	return c.JSON(http.StatusOK, messages)
-}
\ No newline at end of file
+	page := MessagesPage{Messages: messages}
+	if len(messages) > limit {
+		if q.Forward {
+			page.Messages = messages[:limit]
+			page.NextCursor = &page.Messages[limit-1].ID
+		} else {
+			page.Messages = messages[1:]
+			page.NextCursor = &page.Messages[0].ID
+		}
+	}
+
+	return c.JSON(http.StatusOK, page)
+}
+
+// parseMessageQuery разбирает параметры before, after и limit запроса.
+func parseMessageQuery(c echo.Context) (repository.MessageQuery, error) {
+	q := repository.MessageQuery{Limit: defaultMessagesLimit}
+
+	if raw := c.QueryParam("before"); raw != "" {
+		before, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || before <= 0 {
+			return q, errors.New("invalid before cursor")
+		}
+		q.BeforeID = before
+	}
+
+	if raw := c.QueryParam("after"); raw != "" {
+		after, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || after < 0 {
+			return q, errors.New("invalid after cursor")
+		}
+		q.AfterID = after
+		q.Forward = true
+	}
+
+	if raw := c.QueryParam("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return q, errors.New("invalid limit")
+		}
+		q.Limit = min(limit, maxMessagesLimit)
+	}
+
+	return q, nil
+}
+
+type EditMessageRequest struct {
+	Content string `json:"content" validate:"required,max=1000"`
+}
+
+// EditMessage обрабатывает редактирование сообщения. Редактировать сообщение может
+// только его автор: модераторы могут удалить чужое сообщение, но не переписать его.
+func (h *RoomHandler) EditMessage(c echo.Context) error {
+	roomID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	messageID, err := strconv.ParseInt(c.Param("msg_id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid message ID"})
+	}
+
+	req := new(EditMessageRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	ctx := c.Request().Context()
+	userID := userClaims(c).UserID
+	if _, err := requireRoomPermission(ctx, h.roomRepo, roomID, userID, domain.PermPostMessage); err != nil {
+		return roomAccessError(c, err)
+	}
+
+	message, err := h.roomRepo.GetMessage(ctx, roomID, messageID)
+	if err != nil {
+		return messageError(c, err)
+	}
+
+	if message.UserID != userID {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Only the author can edit the message"})
+	}
+
+	message.Content = req.Content
+	if err := h.roomRepo.UpdateMessageContent(ctx, message); err != nil {
+		return messageError(c, err)
+	}
+
+	broadcastEvent(ctx, h.hubManager, roomID, domain.NewEvent(domain.EventMessageEdited, message))
+	h.unfurler.Enqueue(message)
+
+	return c.JSON(http.StatusOK, message)
+}
+
+// DeleteMessage обрабатывает удаление сообщения его автором или модератором комнаты.
+// Сообщение остается в истории как надгробие без текста.
+func (h *RoomHandler) DeleteMessage(c echo.Context) error {
+	roomID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	messageID, err := strconv.ParseInt(c.Param("msg_id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid message ID"})
+	}
+
+	ctx := c.Request().Context()
+	userID := userClaims(c).UserID
+	access, err := checkRoomAccess(ctx, h.roomRepo, roomID, userID)
+	if err != nil {
+		return roomAccessError(c, err)
+	}
+
+	message, err := h.roomRepo.GetMessage(ctx, roomID, messageID)
+	if err != nil {
+		return messageError(c, err)
+	}
+
+	if message.UserID != userID && !access.can(domain.PermRemoveMessage) {
+		return roomAccessError(c, errForbidden)
+	}
+
+	if err := h.roomRepo.DeleteMessage(ctx, message); err != nil {
+		return messageError(c, err)
+	}
+
+	broadcastEvent(ctx, h.hubManager, roomID, domain.NewEvent(domain.EventMessageDeleted, message))
+	if message.ParentID != nil {
+		broadcastThread(ctx, h.roomRepo, h.hubManager, roomID, *message.ParentID)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// messageError преобразует ошибку работы с сообщением в HTTP-ответ.
+// Удаленное сообщение для редактирования и повторного удаления считается отсутствующим.
+func messageError(c echo.Context, err error) error {
+	if errors.Is(err, repository.ErrMessageNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Message not found"})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update message"})
+}
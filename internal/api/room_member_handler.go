@@ -0,0 +1,272 @@
+package api
+
+import (
+	"errors"
+	"go-chat/internal/domain"
+	"go-chat/internal/repository"
+	"net/http"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/labstack/echo/v4"
+)
+
+// JoinRoom добавляет текущего пользователя в публичную комнату.
+func (h *RoomHandler) JoinRoom(c echo.Context) error {
+	roomID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	// В приватную комнату нельзя вступить самостоятельно: для не-участника она не существует.
+	// Исключенного пользователя может вернуть только администратор через AddMember.
+	userID := userClaims(c).UserID
+	if _, err := checkRoomAccess(c.Request().Context(), h.roomRepo, roomID, userID); err != nil {
+		return roomAccessError(c, err)
+	}
+
+	if err := h.roomRepo.AddMember(c.Request().Context(), roomID, userID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to join room"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// LeaveRoom удаляет текущего пользователя из участников комнаты.
+func (h *RoomHandler) LeaveRoom(c echo.Context) error {
+	roomID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	userID := userClaims(c).UserID
+	access, err := checkRoomAccess(c.Request().Context(), h.roomRepo, roomID, userID)
+	if err != nil {
+		return roomAccessError(c, err)
+	}
+
+	if access.role == "" {
+		return memberError(c, repository.ErrNotMember)
+	}
+
+	// Из личной переписки выйти нельзя: второй участник остался бы в ней один,
+	// а новая переписка с ним уже не создастся.
+	if access.room.IsDirect() {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Cannot leave a direct conversation"})
+	}
+
+	// Иначе комната останется без владельца.
+	if access.role == domain.RoleOwner {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Owner cannot leave the room"})
+	}
+
+	if err := h.roomRepo.RemoveMember(c.Request().Context(), roomID, userID); err != nil {
+		if errors.Is(err, repository.ErrNotMember) {
+			return memberError(c, err)
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to leave room"})
+	}
+
+	h.broadcastMemberRemoved(c, roomID, userID)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetMembers обрабатывает получение списка участников комнаты.
+func (h *RoomHandler) GetMembers(c echo.Context) error {
+	roomID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	if _, err := checkRoomAccess(c.Request().Context(), h.roomRepo, roomID, userClaims(c).UserID); err != nil {
+		return roomAccessError(c, err)
+	}
+
+	members, err := h.roomRepo.GetMembers(c.Request().Context(), roomID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch members"})
+	}
+
+	return c.JSON(http.StatusOK, members)
+}
+
+type AddMemberRequest struct {
+	UserID int64 `json:"user_id" validate:"required"`
+}
+
+// AddMember обрабатывает добавление пользователя в комнату администратором.
+// Это единственный способ попасть в приватную комнату и вернуть исключенного участника.
+func (h *RoomHandler) AddMember(c echo.Context) error {
+	roomID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	req := new(AddMemberRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if _, err := requireRoomPermission(c.Request().Context(), h.roomRepo, roomID, userClaims(c).UserID, domain.PermManageMembers); err != nil {
+		return roomAccessError(c, err)
+	}
+
+	if err := h.roomRepo.UnbanMember(c.Request().Context(), roomID, req.UserID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to add member"})
+	}
+
+	if err := h.roomRepo.AddMember(c.Request().Context(), roomID, req.UserID); err != nil {
+		// Нарушение внешнего ключа: такого пользователя нет.
+		if isForeignKeyViolation(err) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to add member"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+type SetMemberRoleRequest struct {
+	Role domain.Role `json:"role" validate:"required,oneof=admin moderator member"`
+}
+
+// SetMemberRole обрабатывает изменение роли участника. Менять роль можно только тем,
+// кто ниже по роли, и только на роль ниже собственной. Владелец не назначается.
+func (h *RoomHandler) SetMemberRole(c echo.Context) error {
+	roomID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	targetID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+	}
+
+	req := new(SetMemberRoleRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	ctx := c.Request().Context()
+	access, err := requireRoomPermission(ctx, h.roomRepo, roomID, userClaims(c).UserID, domain.PermManageMembers)
+	if err != nil {
+		return roomAccessError(c, err)
+	}
+
+	targetRole, err := h.roomRepo.GetMemberRole(ctx, roomID, targetID)
+	if err != nil {
+		return memberError(c, err)
+	}
+
+	if !access.role.Outranks(targetRole) || !access.role.Outranks(req.Role) {
+		return roomAccessError(c, errForbidden)
+	}
+
+	if err := h.roomRepo.SetMemberRole(ctx, roomID, targetID, req.Role); err != nil {
+		return memberError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// KickMember обрабатывает исключение пользователя из комнаты модератором или выше.
+// Исключить можно и не-участника, который пишет в публичную комнату. Исключенный не может
+// читать комнату, писать в нее и вступить в нее снова, пока его не вернет администратор
+// (AddMember) или не снимут запрет (UnbanMember).
+func (h *RoomHandler) KickMember(c echo.Context) error {
+	roomID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	targetID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+	}
+
+	ctx := c.Request().Context()
+	userID := userClaims(c).UserID
+	access, err := requireRoomPermission(ctx, h.roomRepo, roomID, userID, domain.PermKickMember)
+	if err != nil {
+		return roomAccessError(c, err)
+	}
+
+	// У не-участника роль пуста, и исключить его может любой модератор.
+	targetRole, err := h.roomRepo.GetMemberRole(ctx, roomID, targetID)
+	if err != nil && !errors.Is(err, repository.ErrNotMember) {
+		return memberError(c, err)
+	}
+
+	if !access.role.Outranks(targetRole) {
+		return roomAccessError(c, errForbidden)
+	}
+
+	if err := h.roomRepo.BanMember(ctx, roomID, targetID, userID); err != nil {
+		// Нарушение внешнего ключа: такого пользователя нет.
+		if isForeignKeyViolation(err) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+		return memberError(c, err)
+	}
+
+	// Хабы закроют и соединения не-участника, открытые с публичной комнатой.
+	h.broadcastMemberRemoved(c, roomID, targetID)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UnbanMember обрабатывает снятие запрета на возвращение в комнату.
+// Сам пользователь в комнату не добавляется: в публичную он может вступить сам.
+func (h *RoomHandler) UnbanMember(c echo.Context) error {
+	roomID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	targetID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+	}
+
+	ctx := c.Request().Context()
+	if _, err := requireRoomPermission(ctx, h.roomRepo, roomID, userClaims(c).UserID, domain.PermKickMember); err != nil {
+		return roomAccessError(c, err)
+	}
+
+	if err := h.roomRepo.UnbanMember(ctx, roomID, targetID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update member"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// broadcastMemberRemoved сообщает комнате об уходе участника. Хабы закроют
+// его соединения с комнатой.
+func (h *RoomHandler) broadcastMemberRemoved(c echo.Context, roomID, userID int64) {
+	payload := &domain.MemberRemovedPayload{RoomID: roomID, UserID: userID}
+	broadcastEvent(c.Request().Context(), h.hubManager, roomID, domain.NewEvent(domain.EventMemberRemoved, payload))
+}
+
+// memberError преобразует ошибку работы с участником в HTTP-ответ.
+func memberError(c echo.Context, err error) error {
+	if errors.Is(err, repository.ErrNotMember) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Member not found"})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update member"})
+}
+
+// isForeignKeyViolation сообщает, нарушает ли запрос внешний ключ (ссылка на несуществующую запись).
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
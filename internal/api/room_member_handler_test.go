@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-chat/internal/domain"
+	"go-chat/internal/repository"
+	"go-chat/internal/validator"
+	"go-chat/internal/websocket"
+
+	"github.com/labstack/echo/v4"
+)
+
+type memberKey struct {
+	roomID, userID int64
+}
+
+// memRoomRepo хранит комнаты, участников и запреты в памяти.
+type memRoomRepo struct {
+	repository.RoomRepository
+	rooms   map[int64]*domain.Room
+	members map[memberKey]domain.Role
+	bans    map[memberKey]int64
+}
+
+func newMemRoomRepo() *memRoomRepo {
+	return &memRoomRepo{
+		rooms:   map[int64]*domain.Room{},
+		members: map[memberKey]domain.Role{},
+		bans:    map[memberKey]int64{},
+	}
+}
+
+func (r *memRoomRepo) GetRoom(ctx context.Context, roomID int64) (*domain.Room, error) {
+	room, ok := r.rooms[roomID]
+	if !ok {
+		return nil, repository.ErrRoomNotFound
+	}
+	return room, nil
+}
+
+func (r *memRoomRepo) GetMemberRole(ctx context.Context, roomID, userID int64) (domain.Role, error) {
+	role, ok := r.members[memberKey{roomID, userID}]
+	if !ok {
+		return "", repository.ErrNotMember
+	}
+	return role, nil
+}
+
+func (r *memRoomRepo) AddMember(ctx context.Context, roomID, userID int64) error {
+	r.members[memberKey{roomID, userID}] = domain.RoleMember
+	return nil
+}
+
+func (r *memRoomRepo) BanMember(ctx context.Context, roomID, userID, bannedBy int64) error {
+	delete(r.members, memberKey{roomID, userID})
+	r.bans[memberKey{roomID, userID}] = bannedBy
+	return nil
+}
+
+func (r *memRoomRepo) IsBanned(ctx context.Context, roomID, userID int64) (bool, error) {
+	_, ok := r.bans[memberKey{roomID, userID}]
+	return ok, nil
+}
+
+func (r *memRoomRepo) GetMessagesByRoomID(ctx context.Context, roomID int64, q repository.MessageQuery) ([]domain.Message, error) {
+	return []domain.Message{}, nil
+}
+
+const (
+	testRoomID    = 1
+	testModerator = 10
+	testSpammer   = 20
+)
+
+// newBanTest создает публичную комнату с модератором и пользователем, который пишет
+// в нее, не вступая.
+func newBanTest() (*echo.Echo, *memRoomRepo, *RoomHandler) {
+	repo := newMemRoomRepo()
+	repo.rooms[testRoomID] = &domain.Room{ID: testRoomID, Name: "general", Kind: domain.RoomKindRoom, Visibility: domain.RoomPublic}
+	repo.members[memberKey{testRoomID, testModerator}] = domain.RoleModerator
+
+	e := echo.New()
+	e.Validator = validator.NewValidator()
+	return e, repo, NewRoomHandler(repo, websocket.NewHubManager(), nil, nil)
+}
+
+func TestKickMemberBansNonMemberPoster(t *testing.T) {
+	e, repo, h := newBanTest()
+	ctx := context.Background()
+
+	if _, err := requireRoomPermission(ctx, repo, testRoomID, testSpammer, domain.PermPostMessage); err != nil {
+		t.Fatalf("non-member cannot post to a public room before the ban: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/", nil)
+	rec := serveAs(e, h.KickMember, testModerator, req, "id", "1", "user_id", "20")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("KickMember status = %d, want 204: %s", rec.Code, rec.Body)
+	}
+	if repo.bans[memberKey{testRoomID, testSpammer}] != testModerator {
+		t.Fatal("ban was not recorded")
+	}
+
+	if _, err := requireRoomPermission(ctx, repo, testRoomID, testSpammer, domain.PermPostMessage); !errors.Is(err, errBanned) {
+		t.Fatalf("banned user posting: err = %v, want errBanned", err)
+	}
+	rec = serveAs(e, h.JoinRoom, testSpammer, httptest.NewRequest(http.MethodPost, "/", nil), "id", "1")
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("JoinRoom status = %d, want 403", rec.Code)
+	}
+	if _, ok := repo.members[memberKey{testRoomID, testSpammer}]; ok {
+		t.Fatal("banned user joined the room")
+	}
+}
+
+func TestKickMemberRequiresHigherRole(t *testing.T) {
+	e, repo, h := newBanTest()
+	repo.members[memberKey{testRoomID, testSpammer}] = domain.RoleModerator
+
+	rec := serveAs(e, h.KickMember, testModerator, httptest.NewRequest(http.MethodDelete, "/", nil), "id", "1", "user_id", "20")
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("KickMember status = %d, want 403", rec.Code)
+	}
+	if len(repo.bans) != 0 {
+		t.Fatal("moderator banned another moderator")
+	}
+}
+
+func TestBannedUserCannotReadOrConnect(t *testing.T) {
+	e, repo, h := newBanTest()
+
+	read := func() int {
+		return serveAs(e, h.GetMessages, testSpammer, httptest.NewRequest(http.MethodGet, "/", nil), "id", "1").Code
+	}
+	if code := read(); code != http.StatusOK {
+		t.Fatalf("GetMessages before the ban: status = %d, want 200", code)
+	}
+
+	repo.bans[memberKey{testRoomID, testSpammer}] = testModerator
+
+	if code := read(); code != http.StatusForbidden {
+		t.Fatalf("GetMessages after the ban: status = %d, want 403", code)
+	}
+
+	ws := NewWebSocketHandler(websocket.NewHubManager(), repo, nil, nil, nil, e.Validator)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	if rec := serveAs(e, ws.ServeWs, testSpammer, req, "id", "1"); rec.Code != http.StatusForbidden {
+		t.Fatalf("ServeWs after the ban: status = %d, want 403", rec.Code)
+	}
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"errors"
+	"go-chat/internal/domain"
+	"go-chat/internal/repository"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Размер страницы результатов поиска по умолчанию.
+	defaultSearchLimit = 20
+	// Максимальный размер страницы результатов поиска.
+	maxSearchLimit = 50
+	// Максимальная длина поискового запроса.
+	maxSearchQueryLength = 200
+)
+
+type SearchHandler struct {
+	roomRepo repository.RoomRepository
+}
+
+func NewSearchHandler(roomRepo repository.RoomRepository) *SearchHandler {
+	return &SearchHandler{roomRepo: roomRepo}
+}
+
+// SearchPage - страница результатов поиска.
+type SearchPage struct {
+	Results []domain.SearchResult `json:"results"`
+	// NextOffset - значение параметра offset для следующей страницы.
+	// Равно null, если результатов больше нет.
+	NextOffset *int `json:"next_offset"`
+}
+
+// SearchRoom обрабатывает поиск сообщений в одной комнате.
+func (h *SearchHandler) SearchRoom(c echo.Context) error {
+	roomID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	if _, err := checkRoomAccess(c.Request().Context(), h.roomRepo, roomID, userClaims(c).UserID); err != nil {
+		return roomAccessError(c, err)
+	}
+
+	return h.search(c, roomID)
+}
+
+// SearchAll обрабатывает поиск сообщений во всех комнатах, доступных пользователю.
+func (h *SearchHandler) SearchAll(c echo.Context) error {
+	return h.search(c, 0)
+}
+
+func (h *SearchHandler) search(c echo.Context, roomID int64) error {
+	q, err := parseSearchQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	q.RoomID = roomID
+
+	limit := q.Limit
+	// Запрашиваем на один результат больше, чтобы понять, есть ли следующая страница.
+	q.Limit++
+	results, err := h.roomRepo.SearchMessages(c.Request().Context(), userClaims(c).UserID, q)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to search messages"})
+	}
+
+	page := SearchPage{Results: results}
+	if len(results) > limit {
+		page.Results = results[:limit]
+		next := q.Offset + limit
+		page.NextOffset = &next
+	}
+
+	return c.JSON(http.StatusOK, page)
+}
+
+// parseSearchQuery разбирает параметры q, limit и offset запроса.
+func parseSearchQuery(c echo.Context) (repository.SearchQuery, error) {
+	q := repository.SearchQuery{
+		Text:  strings.TrimSpace(c.QueryParam("q")),
+		Limit: defaultSearchLimit,
+	}
+
+	if q.Text == "" {
+		return q, errors.New("query parameter q is required")
+	}
+	if len([]rune(q.Text)) > maxSearchQueryLength {
+		return q, errors.New("search query is too long")
+	}
+
+	if raw := c.QueryParam("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return q, errors.New("invalid limit")
+		}
+		q.Limit = min(limit, maxSearchLimit)
+	}
+
+	if raw := c.QueryParam("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return q, errors.New("invalid offset")
+		}
+		q.Offset = offset
+	}
+
+	return q, nil
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"errors"
+	"go-chat/internal/auth"
+	"go-chat/internal/repository"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SessionHandler показывает пользователю его активные сессии и позволяет их завершать.
+type SessionHandler struct {
+	auth *auth.Service
+}
+
+func NewSessionHandler(authService *auth.Service) *SessionHandler {
+	return &SessionHandler{auth: authService}
+}
+
+// GetSessions возвращает активные сессии текущего пользователя.
+func (h *SessionHandler) GetSessions(c echo.Context) error {
+	claims := userClaims(c)
+	sessions, err := h.auth.Sessions(c.Request().Context(), claims.UserID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch sessions"})
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == claims.SessionID
+	}
+
+	return c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession завершает одну из сессий текущего пользователя.
+func (h *SessionHandler) RevokeSession(c echo.Context) error {
+	sessionID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid session ID"})
+	}
+
+	claims := userClaims(c)
+	if err := h.auth.RevokeSession(c.Request().Context(), claims.UserID, sessionID); err != nil {
+		if errors.Is(err, repository.ErrSessionNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Session not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to revoke session"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RevokeOtherSessions завершает все сессии текущего пользователя, кроме той, из которой пришел запрос.
+func (h *SessionHandler) RevokeOtherSessions(c echo.Context) error {
+	claims := userClaims(c)
+	revoked, err := h.auth.RevokeOtherSessions(c.Request().Context(), claims.UserID, claims.SessionID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to revoke sessions"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]int{"revoked": revoked})
+}
+
+// requestDevice описывает устройство, с которого пришел запрос.
+func requestDevice(c echo.Context) auth.Device {
+	return auth.Device{UserAgent: c.Request().UserAgent(), IP: c.RealIP()}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"go-chat/internal/auth"
+	"go-chat/internal/oidc"
+	"go-chat/internal/repository"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Cookie, в которой браузер хранит state начатого входа. Сверка state из адреса
+// с cookie не дает подсунуть пользователю чужой вход (login CSRF).
+const ssoStateCookie = "oidc_state"
+
+// SSOHandler выполняет вход через провайдера OpenID Connect.
+type SSOHandler struct {
+	sso       *auth.SSOService
+	auth      *auth.Service
+	twoFactor *auth.TwoFactorService
+	// secureCookie - выставлять cookie только для HTTPS.
+	secureCookie bool
+	cookiePath   string
+}
+
+func NewSSOHandler(sso *auth.SSOService, authService *auth.Service, twoFactor *auth.TwoFactorService, secureCookie bool, cookiePath string) *SSOHandler {
+	return &SSOHandler{sso: sso, auth: authService, twoFactor: twoFactor, secureCookie: secureCookie, cookiePath: cookiePath}
+}
+
+// Login перенаправляет браузер на страницу входа провайдера.
+func (h *SSOHandler) Login(c echo.Context) error {
+	state, authURL, err := h.sso.Begin(c.Request().Context())
+	if err != nil {
+		c.Logger().Errorf("failed to start oidc login: %v", err)
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": "Identity provider is unavailable"})
+	}
+
+	c.SetCookie(h.stateCookie(state, int(auth.SSOLoginTTL.Seconds())))
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback принимает пользователя, вернувшегося от провайдера, и выдает токены чата.
+func (h *SSOHandler) Callback(c echo.Context) error {
+	if errParam := c.QueryParam("error"); errParam != "" {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Login was rejected by the identity provider: " + errParam})
+	}
+
+	state, code := c.QueryParam("state"), c.QueryParam("code")
+	if state == "" || code == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Missing state or code"})
+	}
+
+	cookie, err := c.Cookie(ssoStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid login state"})
+	}
+	c.SetCookie(h.stateCookie("", -1))
+
+	user, err := h.sso.Complete(c.Request().Context(), state, code)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrOIDCLoginInvalid):
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid or expired login state"})
+		case errors.Is(err, oidc.ErrInvalidIDToken):
+			c.Logger().Warnf("oidc: %v", err)
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid ID token"})
+		case errors.Is(err, auth.ErrSSOEmailNotVerified):
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Identity provider did not return a verified email"})
+		case errors.Is(err, auth.ErrSSOUserNotFound):
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "No account is registered for this email"})
+		case errors.Is(err, auth.ErrSSOAccountNotVerified):
+			return c.JSON(http.StatusConflict, map[string]string{"error": "An account with this email exists but its email is not verified, log in with a password and verify it first"})
+		}
+		c.Logger().Errorf("failed to complete oidc login: %v", err)
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": "Failed to complete login"})
+	}
+
+	return respondLogin(c, h.auth, h.twoFactor, user)
+}
+
+func (h *SSOHandler) stateCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     ssoStateCookie,
+		Value:    value,
+		Path:     h.cookiePath,
+		MaxAge:   maxAge,
+		Secure:   h.secureCookie,
+		HttpOnly: true,
+		// Lax: cookie должна прийти при переходе с сайта провайдера обратно к нам.
+		SameSite: http.SameSiteLaxMode,
+	}
+}
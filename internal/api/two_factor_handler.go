@@ -0,0 +1,97 @@
+package api
+
+import (
+	"errors"
+	"go-chat/internal/auth"
+	"go-chat/internal/repository"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TwoFactorHandler подключает и отключает второй фактор входа для текущего пользователя.
+type TwoFactorHandler struct {
+	userRepo  repository.UserRepository
+	twoFactor *auth.TwoFactorService
+}
+
+func NewTwoFactorHandler(userRepo repository.UserRepository, twoFactor *auth.TwoFactorService) *TwoFactorHandler {
+	return &TwoFactorHandler{userRepo: userRepo, twoFactor: twoFactor}
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required,max=64"`
+}
+
+// Enroll создает TOTP-секрет и возвращает otpauth://-ссылку для QR-кода.
+// Повторный вызов до подтверждения заменяет секрет.
+func (h *TwoFactorHandler) Enroll(c echo.Context) error {
+	ctx := c.Request().Context()
+	user, err := h.userRepo.GetByID(ctx, userClaims(c).UserID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch user"})
+	}
+
+	enrollment, err := h.twoFactor.Enroll(ctx, user)
+	if err != nil {
+		if errors.Is(err, repository.ErrTwoFactorEnabled) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Two-factor authentication is already enabled"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to enroll two-factor authentication"})
+	}
+
+	return c.JSON(http.StatusOK, enrollment)
+}
+
+// Confirm включает второй фактор по коду из приложения и возвращает коды восстановления.
+func (h *TwoFactorHandler) Confirm(c echo.Context) error {
+	req := new(TwoFactorCodeRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	codes, err := h.twoFactor.Confirm(c.Request().Context(), userClaims(c).UserID, req.Code)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string][]string{"recovery_codes": codes})
+}
+
+// Disable отключает второй фактор. Нужен код из приложения или код восстановления.
+func (h *TwoFactorHandler) Disable(c echo.Context) error {
+	req := new(TwoFactorCodeRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := h.twoFactor.Disable(c.Request().Context(), userClaims(c).UserID, req.Code, requestDevice(c)); err != nil {
+		var throttled *auth.ThrottledError
+		if errors.As(err, &throttled) {
+			return throttledError(c, throttled)
+		}
+		return twoFactorError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func twoFactorError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidCode):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid two-factor code"})
+	case errors.Is(err, repository.ErrTwoFactorNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Two-factor authentication is not enrolled"})
+	case errors.Is(err, repository.ErrTwoFactorEnabled):
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Two-factor authentication is already enabled"})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update two-factor authentication"})
+}
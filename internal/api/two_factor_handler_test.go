@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-chat/internal/auth"
+	"go-chat/internal/domain"
+	"go-chat/internal/repository"
+	"go-chat/internal/totp"
+	"go-chat/internal/validator"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// memThrottleRepo хранит счетчики неудачных входов в памяти.
+type memThrottleRepo struct {
+	failures map[string]int
+	locked   map[string]time.Time
+}
+
+func (r *memThrottleRepo) LockedUntil(ctx context.Context, keys []string) (time.Time, error) {
+	var until time.Time
+	for _, key := range keys {
+		if t := r.locked[key]; t.After(until) {
+			until = t
+		}
+	}
+	return until, nil
+}
+
+func (r *memThrottleRepo) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	r.failures[key]++
+	return r.failures[key], nil
+}
+
+func (r *memThrottleRepo) Lock(ctx context.Context, key string, until time.Time) error {
+	r.locked[key] = until
+	return nil
+}
+
+func (r *memThrottleRepo) Reset(ctx context.Context, key string) error {
+	delete(r.failures, key)
+	delete(r.locked, key)
+	return nil
+}
+
+func (r *memThrottleRepo) LogFailure(ctx context.Context, failure *domain.FailedLogin) error {
+	return nil
+}
+
+// memTwoFactorRepo хранит подключенный второй фактор одного пользователя.
+type memTwoFactorRepo struct {
+	repository.TwoFactorRepository
+	tf *domain.TwoFactor
+}
+
+func (r *memTwoFactorRepo) Get(ctx context.Context, userID int64) (*domain.TwoFactor, error) {
+	if r.tf == nil || r.tf.UserID != userID {
+		return nil, repository.ErrTwoFactorNotFound
+	}
+	return r.tf, nil
+}
+
+func (r *memTwoFactorRepo) UseStep(ctx context.Context, userID, step int64) (bool, error) {
+	if step <= r.tf.LastUsedStep {
+		return false, nil
+	}
+	r.tf.LastUsedStep = step
+	return true, nil
+}
+
+func (r *memTwoFactorRepo) UseRecoveryCode(ctx context.Context, userID int64, codeHash []byte) (bool, error) {
+	return false, nil
+}
+
+func (r *memTwoFactorRepo) Delete(ctx context.Context, userID int64) error {
+	r.tf = nil
+	return nil
+}
+
+type memUserRepo struct {
+	repository.UserRepository
+	user *domain.User
+}
+
+func (r *memUserRepo) GetByID(ctx context.Context, id int64) (*domain.User, error) {
+	if id != r.user.ID {
+		return nil, repository.ErrUserNotFound
+	}
+	return r.user, nil
+}
+
+// serveAs выполняет обработчик от имени пользователя userID. params - пары имя, значение
+// параметров пути.
+func serveAs(e *echo.Echo, handler echo.HandlerFunc, userID int64, req *http.Request, params ...string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	var names, values []string
+	for i := 0; i+1 < len(params); i += 2 {
+		names = append(names, params[i])
+		values = append(values, params[i+1])
+	}
+	c.SetParamNames(names...)
+	c.SetParamValues(values...)
+	c.Set("user", &jwt.Token{Claims: &domain.JWTCustomClaims{UserID: userID}})
+	if err := handler(c); err != nil {
+		e.HTTPErrorHandler(err, c)
+	}
+	return rec
+}
+
+func TestDisableTwoFactorLocksAfterWrongCodes(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirmed := time.Now()
+	twoFactorRepo := &memTwoFactorRepo{tf: &domain.TwoFactor{UserID: 1, Secret: secret, ConfirmedAt: &confirmed}}
+	users := &memUserRepo{user: &domain.User{ID: 1, Email: "alice@example.com"}}
+	const maxFailures = 5
+	guard := auth.NewLoginGuard(&memThrottleRepo{failures: map[string]int{}, locked: map[string]time.Time{}}, users, auth.LoginGuardConfig{
+		MaxFailures:   maxFailures,
+		Lockout:       time.Minute,
+		FailureWindow: time.Hour,
+	})
+	h := NewTwoFactorHandler(users, auth.NewTwoFactorService(twoFactorRepo, users, nil, guard, "go-chat", time.Minute))
+
+	e := echo.New()
+	e.Validator = validator.NewValidator()
+	disable := func(code string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/me/2fa/disable", strings.NewReader(`{"code":"`+code+`"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		return serveAs(e, h.Disable, 1, req)
+	}
+
+	for i := range maxFailures {
+		if rec := disable("000000"); rec.Code != http.StatusBadRequest {
+			t.Fatalf("attempt %d: status = %d, want 400", i, rec.Code)
+		}
+	}
+
+	// Теперь не принимается даже верный код.
+	rec := disable(totp.Code(secret, totp.Step(time.Now())))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status after %d wrong codes = %d, want 429", maxFailures, rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("429 response has no Retry-After")
+	}
+	if twoFactorRepo.tf == nil {
+		t.Fatal("two-factor authentication was disabled while locked")
+	}
+}
@@ -2,11 +2,13 @@ package api
 
 import (
 	"errors"
+	"go-chat/internal/auth"
 	"go-chat/internal/config"
 	"go-chat/internal/domain"
 	"go-chat/internal/repository"
+	"math"
 	"net/http"
-	"time"
+	"strconv"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -15,12 +17,16 @@ import (
 )
 
 type UserHandler struct {
-	userRepo repository.UserRepository
-	cfg      *config.Config
+	userRepo   repository.UserRepository
+	auth       *auth.Service
+	accounts   *auth.AccountService
+	twoFactor  *auth.TwoFactorService
+	loginGuard *auth.LoginGuard
+	cfg        *config.Config
 }
 
-func NewUserHandler(userRepo repository.UserRepository, cfg *config.Config) *UserHandler {
-	return &UserHandler{userRepo: userRepo, cfg: cfg}
+func NewUserHandler(userRepo repository.UserRepository, authService *auth.Service, accounts *auth.AccountService, twoFactor *auth.TwoFactorService, loginGuard *auth.LoginGuard, cfg *config.Config) *UserHandler {
+	return &UserHandler{userRepo: userRepo, auth: authService, accounts: accounts, twoFactor: twoFactor, loginGuard: loginGuard, cfg: cfg}
 }
 
 type RegisterRequest struct {
@@ -61,6 +67,8 @@ func (h *UserHandler) Register(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create user"})
 	}
 
+	h.accounts.SendVerificationInBackground(user)
+
 	return c.JSON(http.StatusCreated, user)
 }
 
@@ -79,34 +87,125 @@ func (h *UserHandler) Login(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
-	user, err := h.userRepo.GetByEmail(c.Request().Context(), req.Email)
+	user, err := h.loginGuard.Authenticate(c.Request().Context(), req.Email, req.Password, requestDevice(c))
 	if err != nil {
-		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid email or password"})
+		var throttled *auth.ThrottledError
+		switch {
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid email or password"})
+		case errors.As(err, &throttled):
+			return throttledError(c, throttled)
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to log in"})
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
+	return respondLogin(c, h.auth, h.twoFactor, user)
+}
+
+// respondLogin завершает вход пользователя, личность которого уже подтверждена
+// (паролем или внешним провайдером). С подключенным вторым фактором этого недостаточно:
+// клиент получает mfa_token и обменивает его на токены вместе с кодом в LoginTwoFactor.
+func respondLogin(c echo.Context, authService *auth.Service, twoFactor *auth.TwoFactorService, user *domain.User) error {
+	mfaEnabled, err := twoFactor.Enabled(c.Request().Context(), user.ID)
 	if err != nil {
-		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid email or password"})
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check two-factor authentication"})
 	}
-
-	claims := &domain.JWTCustomClaims{
-		UserID:   user.ID,
-		Username: user.Username,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 72)),
-		},
+	if mfaEnabled {
+		challenge, err := twoFactor.Challenge(c.Request().Context(), user)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start two-factor authentication"})
+		}
+		return c.JSON(http.StatusOK, challenge)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	tokenString, err := token.SignedString([]byte(h.cfg.JWTSecret))
+	tokens, err := authService.StartSession(c.Request().Context(), user, requestDevice(c))
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "Failed to generate token",
 		})
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{"token": tokenString})
+	return c.JSON(http.StatusOK, tokens)
+}
+
+type LoginTwoFactorRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	// Code - код из приложения-аутентификатора или код восстановления.
+	Code string `json:"code" validate:"required,max=64"`
+}
+
+// LoginTwoFactor завершает вход с подключенным вторым фактором.
+func (h *UserHandler) LoginTwoFactor(c echo.Context) error {
+	req := new(LoginTwoFactorRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	tokens, err := h.twoFactor.Verify(c.Request().Context(), req.MFAToken, req.Code, requestDevice(c))
+	if err != nil {
+		var throttled *auth.ThrottledError
+		switch {
+		case errors.Is(err, auth.ErrInvalidCode):
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid two-factor code"})
+		case errors.As(err, &throttled):
+			return throttledError(c, throttled)
+		case errors.Is(err, repository.ErrMFAChallengeInvalid), errors.Is(err, repository.ErrTwoFactorNotFound):
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid or expired MFA token, log in again"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate token"})
+	}
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// throttledError отвечает 429 с заголовком Retry-After.
+func throttledError(c echo.Context, throttled *auth.ThrottledError) error {
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+	return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "Too many failed login attempts, try again later"})
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// Refresh обменивает refresh-токен на новую пару токенов.
+func (h *UserHandler) Refresh(c echo.Context) error {
+	req := new(RefreshRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	tokens, err := h.auth.Refresh(c.Request().Context(), req.RefreshToken, requestDevice(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRefreshTokenReused):
+			c.Logger().Warnf("refresh token reuse detected, session revoked")
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Refresh token has already been used, session revoked"})
+		case errors.Is(err, repository.ErrRefreshTokenInvalid), errors.Is(err, repository.ErrUserNotFound):
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid or expired refresh token"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to refresh token"})
+	}
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// Logout завершает текущую сессию: ее access- и refresh-токены больше не принимаются.
+func (h *UserHandler) Logout(c echo.Context) error {
+	claims := userClaims(c)
+	if err := h.auth.RevokeSession(c.Request().Context(), claims.UserID, claims.SessionID); err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to log out"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
 }
 
 func (h *UserHandler) Me(c echo.Context) error {
@@ -1,21 +1,37 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"go-chat/internal/domain"
+	"go-chat/internal/repository"
+	"go-chat/internal/unfurl"
 	ws "go-chat/internal/websocket"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 )
 
+const (
+	// Время на обработку одного входящего кадра.
+	frameTimeout = 5 * time.Second
+	// Сколько пропущенных сообщений читать из БД за один запрос при восстановлении сессии.
+	replayBatchSize = 200
+	// Максимум пропущенных сообщений, которые досылаются через WebSocket.
+	// Если пропущено больше, клиент должен перезагрузить историю через REST.
+	maxReplayMessages = 1000
+)
+
 var (
 	upgrader = websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
+		Subprotocols:    []string{ws.Subprotocol},
 		CheckOrigin: func(r *http.Request) bool {
 			// Для разработки разрешаем все источники.
 			// В продакшене здесь должна быть проверка на ваш домен фронтенда.
@@ -26,10 +42,15 @@ var (
 
 type WebSocketHandler struct {
 	hubManager *ws.HubManager
+	roomRepo   repository.RoomRepository
+	readRepo   repository.ReadRepository
+	unfurler   *unfurl.Worker
+	posting    *PostingPolicy
+	validator  echo.Validator
 }
 
-func NewWebSocketHandler(hubManager *ws.HubManager) *WebSocketHandler {
-	return &WebSocketHandler{hubManager: hubManager}
+func NewWebSocketHandler(hubManager *ws.HubManager, roomRepo repository.RoomRepository, readRepo repository.ReadRepository, unfurler *unfurl.Worker, posting *PostingPolicy, validator echo.Validator) *WebSocketHandler {
+	return &WebSocketHandler{hubManager: hubManager, roomRepo: roomRepo, readRepo: readRepo, unfurler: unfurler, posting: posting, validator: validator}
 }
 
 // ServeWs обрабатывает WebSocket запросы.
@@ -39,31 +60,194 @@ func (h *WebSocketHandler) ServeWs(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
 	}
 
+	// since - ID последнего сообщения, которое клиент видел до переподключения.
+	var since int64
+	if raw := c.QueryParam("since"); raw != "" {
+		since, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || since < 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid since parameter"})
+		}
+	}
+
+	claims := userClaims(c)
+	if _, err := checkRoomAccess(c.Request().Context(), h.roomRepo, roomID, claims.UserID); err != nil {
+		return roomAccessError(c, err)
+	}
+
 	conn, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
 	if err != nil {
 		log.Printf("failed to upgrade connection: %v", err)
 		return err
 	}
 
-	userToken := c.Get("user").(*jwt.Token)
-	claims := userToken.Claims.(*domain.JWTCustomClaims)
-	userID := claims.UserID
-
-	// Получаем или создаем хаб для конкретной комнаты
-	hub := h.hubManager.GetOrCreateHub(roomID)
-
 	client := &ws.Client{
-		Hub:    hub,
-		Conn:   conn,
-		Send:   make(chan *domain.Message, 256),
-		UserID: userID,
-		RoomID: roomID,
+		Conn:      conn,
+		Send:      make(chan *domain.Event, 256),
+		UserID:    claims.UserID,
+		Username:  claims.Username,
+		SessionID: claims.SessionID,
+		RoomID:    roomID,
+		Handler:   h,
+		Legacy:    conn.Subprotocol() != ws.Subprotocol,
 	}
-	client.Hub.Register(client)
+	// Регистрируем клиента в хабе комнаты, создавая хаб при необходимости.
+	h.hubManager.Register(client)
 
-	// Запускаем обработчики чтения и записи в отдельных горутинах.
+	// WritePump запускается до загрузки пропущенных сообщений: пока идет запрос, он
+	// разбирает очередь Send, и хаб не отключит клиента в оживленной комнате.
+	if since > 0 {
+		client.ExpectReplay()
+	}
 	go client.WritePump()
+
+	// Пропущенные сообщения читаются уже после регистрации в хабе, поэтому между историей
+	// и живыми событиями нет разрыва, а пересечение отбросит Client при отправке.
+	if since > 0 {
+		missed, complete, err := h.missedMessages(c.Request().Context(), roomID, since)
+		if err != nil {
+			log.Printf("failed to load missed messages: %v", err)
+			client.SendError(0, "Failed to load missed messages")
+		} else if !complete {
+			client.SendError(0, "Too many missed messages, reload history")
+		}
+		client.SetReplay(missed)
+	}
+
 	go client.ReadPump()
 
 	return nil
 }
+
+// missedMessages загружает сообщения комнаты с ID больше since.
+// complete равно false, если пропущено больше maxReplayMessages.
+func (h *WebSocketHandler) missedMessages(ctx context.Context, roomID, since int64) (messages []domain.Message, complete bool, err error) {
+	for len(messages) < maxReplayMessages {
+		q := repository.MessageQuery{AfterID: since, Forward: true, Limit: replayBatchSize, WithReplies: true}
+		batch, err := h.roomRepo.GetMessagesByRoomID(ctx, roomID, q)
+		if err != nil {
+			return messages, false, err
+		}
+		messages = append(messages, batch...)
+		if len(batch) < replayBatchSize {
+			return messages, true, nil
+		}
+		since = batch[len(batch)-1].ID
+	}
+	return messages, false, nil
+}
+
+// HandleFrame обрабатывает кадр, полученный от клиента через WebSocket.
+func (h *WebSocketHandler) HandleFrame(client *ws.Client, frame *ws.InboundFrame) {
+	switch frame.Type {
+	case ws.FrameTypeMessageCreate:
+		h.handleMessage(client, frame)
+	case ws.FrameTypeReadMark:
+		h.handleReadMark(client, frame)
+	case ws.FrameTypeTypingStart, ws.FrameTypeTypingStop:
+		// Индикаторы набора эфемерны: хаб только пересылает их и никуда не сохраняет.
+		client.Hub.Typing(client, frame.Type == ws.FrameTypeTypingStart)
+	default:
+		client.SendError(frame.Seq, "Unknown frame type")
+	}
+}
+
+// handleMessage сохраняет сообщение клиента, рассылает его в комнату и подтверждает отправителю.
+func (h *WebSocketHandler) handleMessage(client *ws.Client, frame *ws.InboundFrame) {
+	req := new(PostMessageRequest)
+	if err := json.Unmarshal(frame.Payload, req); err != nil {
+		client.SendError(frame.Seq, "Invalid payload")
+		return
+	}
+	req.normalize()
+	if err := h.validator.Validate(req); err != nil {
+		client.SendError(frame.Seq, err.Error())
+		return
+	}
+
+	message := &domain.Message{
+		RoomID:   client.RoomID,
+		UserID:   client.UserID,
+		Username: client.Username,
+		Content:  req.Content,
+		ParentID: req.ParentID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), frameTimeout)
+	defer cancel()
+
+	// Права могли измениться уже после подключения.
+	if _, err := requireRoomPermission(ctx, h.roomRepo, client.RoomID, client.UserID, domain.PermPostMessage); err != nil {
+		client.SendError(frame.Seq, frameAccessError(err))
+		return
+	}
+	if err := h.posting.check(ctx, client.UserID); err != nil {
+		client.SendError(frame.Seq, frameAccessError(err))
+		return
+	}
+
+	if err := publishMessage(ctx, h.roomRepo, h.hubManager, h.unfurler, message, req.AttachmentIDs); err != nil {
+		if errors.Is(err, repository.ErrParentNotFound) {
+			client.SendError(frame.Seq, "Parent message not found")
+			return
+		}
+		if errors.Is(err, repository.ErrAttachmentNotFound) {
+			client.SendError(frame.Seq, "Invalid attachment")
+			return
+		}
+		log.Printf("failed to save websocket message: %v", err)
+		client.SendError(frame.Seq, "Failed to save message")
+		return
+	}
+
+	client.SendAck(frame.Seq, message.ID)
+}
+
+// handleReadMark продвигает отметку прочтения комнаты и подтверждает ее отправителю.
+func (h *WebSocketHandler) handleReadMark(client *ws.Client, frame *ws.InboundFrame) {
+	req := new(MarkReadRequest)
+	if err := json.Unmarshal(frame.Payload, req); err != nil {
+		client.SendError(frame.Seq, "Invalid payload")
+		return
+	}
+	if err := h.validator.Validate(req); err != nil {
+		client.SendError(frame.Seq, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), frameTimeout)
+	defer cancel()
+
+	access, err := checkRoomAccess(ctx, h.roomRepo, client.RoomID, client.UserID)
+	if err != nil {
+		client.SendError(frame.Seq, frameAccessError(err))
+		return
+	}
+
+	marker, err := markRead(ctx, h.readRepo, h.hubManager, access, client.UserID, client.Username, req.MessageID)
+	if err != nil {
+		if errors.Is(err, repository.ErrMessageNotFound) {
+			client.SendError(frame.Seq, "Message not found")
+			return
+		}
+		log.Printf("failed to mark websocket read: %v", err)
+		client.SendError(frame.Seq, "Failed to update read marker")
+		return
+	}
+
+	client.SendAck(frame.Seq, marker.LastReadMessageID)
+}
+
+// frameAccessError возвращает текст ошибки проверки доступа для клиента WebSocket.
+func frameAccessError(err error) string {
+	switch {
+	case errors.Is(err, repository.ErrRoomNotFound):
+		return "Room not found"
+	case errors.Is(err, errForbidden):
+		return "Insufficient permissions"
+	case errors.Is(err, errBanned):
+		return "You are banned from this room"
+	case errors.Is(err, errEmailNotVerified):
+		return "Email address is not verified"
+	}
+	return "Failed to fetch room"
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-chat/internal/domain"
+	"go-chat/internal/mail"
+	"go-chat/internal/repository"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrEmailAlreadyVerified означает, что подтверждать адрес больше не нужно.
+var ErrEmailAlreadyVerified = errors.New("email already verified")
+
+// Время на отправку письма в фоне.
+const mailTimeout = 30 * time.Second
+
+// AccountConfig - параметры писем с одноразовыми ссылками.
+type AccountConfig struct {
+	// AppURL - адрес клиента, на страницы которого ведут ссылки из писем.
+	AppURL           string
+	VerificationTTL  time.Duration
+	PasswordResetTTL time.Duration
+}
+
+// AccountService подтверждает адреса почты и восстанавливает доступ по ссылкам из писем.
+type AccountService struct {
+	users  repository.UserRepository
+	tokens repository.UserTokenRepository
+	mailer mail.Mailer
+	auth   *Service
+	cfg    AccountConfig
+}
+
+func NewAccountService(users repository.UserRepository, tokens repository.UserTokenRepository, mailer mail.Mailer, authService *Service, cfg AccountConfig) *AccountService {
+	cfg.AppURL = strings.TrimRight(cfg.AppURL, "/")
+	return &AccountService{users: users, tokens: tokens, mailer: mailer, auth: authService, cfg: cfg}
+}
+
+// SendVerification отправляет пользователю письмо со ссылкой для подтверждения адреса.
+func (a *AccountService) SendVerification(ctx context.Context, user *domain.User) error {
+	if user.IsEmailVerified() {
+		return ErrEmailAlreadyVerified
+	}
+
+	token, err := a.newUserToken(ctx, user.ID, domain.TokenPurposeEmailVerification, a.cfg.VerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return a.mailer.Send(ctx, &mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nplease confirm your email address by opening the link below:\n\n%s\n\nThe link expires in %s.\n",
+			user.Username, a.link("/verify-email", token), a.cfg.VerificationTTL),
+	})
+}
+
+// SendVerificationInBackground отправляет письмо для подтверждения адреса, не задерживая
+// ответ клиенту. Ошибка только логируется: письмо можно запросить повторно.
+func (a *AccountService) SendVerificationInBackground(user *domain.User) {
+	a.background(func(ctx context.Context) error {
+		err := a.SendVerification(ctx, user)
+		if errors.Is(err, ErrEmailAlreadyVerified) {
+			return nil
+		}
+		return err
+	})
+}
+
+// VerifyEmail подтверждает адрес по токену из письма.
+func (a *AccountService) VerifyEmail(ctx context.Context, token string) error {
+	_, err := a.tokens.VerifyEmail(ctx, hashToken(token))
+	return err
+}
+
+// RequestPasswordReset отправляет письмо со ссылкой для сброса пароля, если адрес
+// зарегистрирован. Работа выполняется в фоне, чтобы по времени ответа нельзя было
+// понять, есть ли такой пользователь.
+func (a *AccountService) RequestPasswordReset(email string) {
+	a.background(func(ctx context.Context) error {
+		user, err := a.users.GetByEmail(ctx, email)
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		token, err := a.newUserToken(ctx, user.ID, domain.TokenPurposePasswordReset, a.cfg.PasswordResetTTL)
+		if err != nil {
+			return err
+		}
+
+		return a.mailer.Send(ctx, &mail.Message{
+			To:      user.Email,
+			Subject: "Reset your password",
+			Body: fmt.Sprintf("Hi %s,\n\nsomeone requested a password reset for your account. To choose a new password, open the link below:\n\n%s\n\nThe link expires in %s. If you did not request this, ignore this email.\n",
+				user.Username, a.link("/reset-password", token), a.cfg.PasswordResetTTL),
+		})
+	})
+}
+
+// ResetPassword меняет пароль по токену из письма. Все сессии пользователя отзываются,
+// так что тот, кто знал старый пароль, теряет доступ.
+func (a *AccountService) ResetPassword(ctx context.Context, token, password string) error {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	userID, revoked, err := a.tokens.ResetPassword(ctx, hashToken(token), string(passwordHash))
+	if err != nil {
+		return err
+	}
+	if len(revoked) > 0 {
+		a.auth.notify(ctx, userID, revoked)
+	}
+	return nil
+}
+
+func (a *AccountService) newUserToken(ctx context.Context, userID int64, purpose domain.TokenPurpose, ttl time.Duration) (string, error) {
+	token, tokenHash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	if err := a.tokens.Create(ctx, userID, purpose, tokenHash, time.Now().Add(ttl)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (a *AccountService) link(path, token string) string {
+	return a.cfg.AppURL + path + "?token=" + url.QueryEscape(token)
+}
+
+func (a *AccountService) background(fn func(ctx context.Context) error) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+		if err := fn(ctx); err != nil {
+			log.Printf("failed to send account email: %v", err)
+		}
+	}()
+}
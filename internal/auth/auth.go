@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"go-chat/internal/domain"
+	"go-chat/internal/repository"
+	"log"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Tokens - пара токенов, которую получает клиент при входе и при обновлении.
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	// ExpiresIn - время жизни access-токена в секундах.
+	ExpiresIn int64 `json:"expires_in"`
+	// Token дублирует AccessToken для клиентов, которые ждут ответ /login в старом формате.
+	Token string `json:"token"`
+}
+
+// Device описывает устройство, с которого выполнен вход или обновление токенов.
+type Device struct {
+	UserAgent string
+	IP        string
+}
+
+// Длина User-Agent, которая сохраняется в сессии.
+const maxUserAgentLength = 512
+
+// RevocationNotifier узнает об отзыве сессий, например чтобы закрыть их соединения.
+type RevocationNotifier interface {
+	SessionsRevoked(ctx context.Context, userID int64, sessionIDs []int64) error
+}
+
+// Service выпускает короткоживущие access-токены (JWT) и ротируемые refresh-токены,
+// привязанные к серверной сессии.
+type Service struct {
+	sessions   repository.SessionRepository
+	users      repository.UserRepository
+	keys       *KeyRing
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	notifier   RevocationNotifier
+}
+
+func NewService(sessions repository.SessionRepository, users repository.UserRepository, keys *KeyRing, accessTTL, refreshTTL time.Duration) *Service {
+	return &Service{
+		sessions:   sessions,
+		users:      users,
+		keys:       keys,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+	}
+}
+
+// SetRevocationNotifier задает, кого уведомлять об отзыве сессий.
+// Должен вызываться до начала обработки запросов.
+func (s *Service) SetRevocationNotifier(n RevocationNotifier) {
+	s.notifier = n
+}
+
+// StartSession создает сессию для пользователя, уже прошедшего проверку, и выпускает токены.
+func (s *Service) StartSession(ctx context.Context, user *domain.User, device Device) (*Tokens, error) {
+	refreshToken, refreshHash, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &domain.Session{UserID: user.ID, UserAgent: device.userAgent(), IP: device.IP}
+	if err := s.sessions.Create(ctx, session, refreshHash, time.Now().Add(s.refreshTTL)); err != nil {
+		return nil, err
+	}
+
+	return s.issue(user, session.ID, refreshToken)
+}
+
+// Refresh обменивает refresh-токен на новую пару токенов. Старый refresh-токен
+// становится недействительным; его повторное предъявление отзывает всю сессию
+// (repository.ErrRefreshTokenReused).
+func (s *Service) Refresh(ctx context.Context, refreshToken string, device Device) (*Tokens, error) {
+	newToken, newHash, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.sessions.RotateRefreshToken(ctx, hashToken(refreshToken), newHash, time.Now().Add(s.refreshTTL), device.userAgent(), device.IP)
+	if errors.Is(err, repository.ErrRefreshTokenReused) {
+		s.notify(ctx, session.UserID, []int64{session.ID})
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.GetByID(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issue(user, session.ID, newToken)
+}
+
+// ParseAccessToken проверяет подпись и срок действия access-токена.
+// Отзыв сессии проверяется отдельно, через CheckSession.
+func (s *Service) ParseAccessToken(raw string) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(raw, new(domain.JWTCustomClaims), s.keys.keyFunc,
+		jwt.WithValidMethods(s.keys.validMethods()),
+		jwt.WithExpirationRequired(),
+	)
+}
+
+// Sessions возвращает активные сессии пользователя.
+func (s *Service) Sessions(ctx context.Context, userID int64) ([]domain.Session, error) {
+	return s.sessions.GetActiveByUser(ctx, userID)
+}
+
+// RevokeSession отзывает сессию пользователя: ее refresh-токены и еще не истекшие
+// access-токены перестают приниматься, а открытые соединения закрываются.
+func (s *Service) RevokeSession(ctx context.Context, userID, sessionID int64) error {
+	if err := s.sessions.Revoke(ctx, userID, sessionID); err != nil {
+		return err
+	}
+	s.notify(ctx, userID, []int64{sessionID})
+	return nil
+}
+
+// RevokeOtherSessions отзывает все сессии пользователя, кроме текущей, и возвращает их число.
+func (s *Service) RevokeOtherSessions(ctx context.Context, userID, currentSessionID int64) (int, error) {
+	revoked, err := s.sessions.RevokeOthers(ctx, userID, currentSessionID)
+	if err != nil {
+		return 0, err
+	}
+	if len(revoked) > 0 {
+		s.notify(ctx, userID, revoked)
+	}
+	return len(revoked), nil
+}
+
+// CheckSession сообщает, принимаются ли еще токены сессии, и отмечает ее использование.
+func (s *Service) CheckSession(ctx context.Context, sessionID int64) (bool, error) {
+	return s.sessions.Touch(ctx, sessionID)
+}
+
+// notify сообщает об отзыве сессий. Сессии к этому моменту уже отозваны в БД,
+// поэтому ошибка уведомления только логируется.
+func (s *Service) notify(ctx context.Context, userID int64, sessionIDs []int64) {
+	if s.notifier == nil {
+		return
+	}
+	if err := s.notifier.SessionsRevoked(ctx, userID, sessionIDs); err != nil {
+		log.Printf("failed to notify about revoked sessions of user %d: %v", userID, err)
+	}
+}
+
+func (s *Service) issue(user *domain.User, sessionID int64, refreshToken string) (*Tokens, error) {
+	claims := &domain.JWTCustomClaims{
+		UserID:    user.ID,
+		Username:  user.Username,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.accessTTL)),
+		},
+	}
+
+	accessToken, err := s.keys.sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.accessTTL / time.Second),
+		Token:        accessToken,
+	}, nil
+}
+
+func (d Device) userAgent() string {
+	if runes := []rune(d.UserAgent); len(runes) > maxUserAgentLength {
+		return string(runes[:maxUserAgentLength])
+	}
+	return d.UserAgent
+}
+
+// newToken генерирует случайный токен (refresh-токен или токен из письма) и его хэш
+// для хранения в БД. Токен содержит 256 случайных бит, поэтому быстрого SHA-256 достаточно.
+func newToken() (string, []byte, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
@@ -0,0 +1,490 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// Как часто перечитывать каталог ключей и проверять, не пора ли сменить ключ.
+	keyReloadInterval = time.Minute
+	// Новый ключ публикуется в JWKS заранее и начинает подписывать токены только
+	// спустя это время, чтобы другие экземпляры и сервисы успели его получить.
+	keyPublishDelay = 10 * time.Minute
+	// Минимальный размер RSA-ключа.
+	minRSAKeyBits = 2048
+	// Префикс файлов, созданных при автоматической смене ключей. Только такие файлы
+	// сервис удаляет сам, остальными управляет администратор.
+	generatedKeyPrefix = "jwt-"
+)
+
+// Алгоритмы подписи, которые поддерживает KeyRing.
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// KeyRingConfig - параметры ключей подписи access-токенов.
+type KeyRingConfig struct {
+	// Dir - каталог с ключами в PEM: закрытыми (подписывают и проверяют) и открытыми
+	// (только проверяют).
+	Dir string
+	// Algorithm - алгоритм новых ключей, создаваемых сервисом: RS256 или EdDSA.
+	Algorithm string
+	// RotationInterval - как часто создавать новый ключ подписи. 0 - не создавать,
+	// если в каталоге уже есть закрытый ключ.
+	RotationInterval time.Duration
+	// RetainFor - сколько после замены ключ еще принимается при проверке.
+	// Должно быть не меньше времени жизни access-токена.
+	RetainFor time.Duration
+	// LegacySecret - прежний общий секрет HS256. Если задан, токены, выпущенные до
+	// перехода на асимметричные ключи, принимаются, пока не истекут. Новые токены
+	// им не подписываются.
+	LegacySecret string
+	// LegacyIssuedBefore - момент перехода на асимметричные ключи, обязателен вместе
+	// с LegacySecret. Принимаются только токены HS256 с iat раньше этого момента, а через
+	// RetainFor после него секрет не принимается вовсе: все выпущенные им токены истекли,
+	// и утечка секрета больше ничего не дает.
+	LegacyIssuedBefore time.Time
+}
+
+// signingKey - ключ из каталога.
+type signingKey struct {
+	id        string
+	algorithm string
+	private   crypto.Signer
+	public    crypto.PublicKey
+	file      string
+	createdAt time.Time
+}
+
+// KeyRing хранит ключи подписи access-токенов: текущий ключ подписи и все ключи,
+// которыми еще могут быть подписаны действующие токены.
+type KeyRing struct {
+	cfg KeyRingConfig
+
+	mu      sync.RWMutex
+	signing *signingKey
+	keys    map[string]*signingKey
+}
+
+// NewKeyRing загружает ключи из каталога. Если закрытого ключа нет или текущий
+// старше RotationInterval, создает новый.
+func NewKeyRing(cfg KeyRingConfig) (*KeyRing, error) {
+	switch cfg.Algorithm {
+	case AlgorithmRS256, AlgorithmEdDSA:
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", cfg.Algorithm)
+	}
+	if cfg.LegacySecret != "" {
+		if cfg.LegacyIssuedBefore.IsZero() {
+			return nil, errors.New("legacy HS256 secret requires the time it was retired")
+		}
+		if time.Now().After(cfg.LegacyIssuedBefore.Add(cfg.RetainFor)) {
+			log.Printf("legacy HS256 secret is no longer accepted: all tokens signed with it have expired, remove it from the configuration")
+		}
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	r := &KeyRing{cfg: cfg}
+	if err := r.refresh(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Run периодически перечитывает каталог ключей и меняет ключ подписи по расписанию.
+func (r *KeyRing) Run(ctx context.Context) {
+	ticker := time.NewTicker(keyReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.refresh(); err != nil {
+				log.Printf("failed to refresh jwt signing keys: %v", err)
+			}
+		}
+	}
+}
+
+// refresh перечитывает каталог, при необходимости создает новый ключ и удаляет
+// созданные сервисом ключи, которые больше не нужны для проверки.
+func (r *KeyRing) refresh() error {
+	keys, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	newest := newestPrivate(keys)
+	if newest == nil || (r.cfg.RotationInterval > 0 && time.Since(newest.createdAt) >= r.cfg.RotationInterval) {
+		key, err := r.generate()
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	signing, active := r.selectKeys(keys)
+
+	ring := make(map[string]*signingKey, len(active))
+	for _, key := range active {
+		ring[key.id] = key
+	}
+
+	r.mu.Lock()
+	r.signing = signing
+	r.keys = ring
+	r.mu.Unlock()
+	return nil
+}
+
+// selectKeys выбирает ключ подписи и ключи, которые еще принимаются при проверке.
+// Ключ подписи - самый новый закрытый ключ, опубликованный не позже чем keyPublishDelay
+// назад (или просто самый новый, если таких нет). Замененный ключ принимается еще
+// RetainFor после того, как его сменил следующий.
+func (r *KeyRing) selectKeys(keys []*signingKey) (*signingKey, []*signingKey) {
+	var private []*signingKey
+	for _, key := range keys {
+		if key.private != nil {
+			private = append(private, key)
+		}
+	}
+	sort.Slice(private, func(i, j int) bool { return private[i].createdAt.After(private[j].createdAt) })
+
+	now := time.Now()
+	signingIdx := 0
+	for i, key := range private {
+		if now.Sub(key.createdAt) >= keyPublishDelay {
+			signingIdx = i
+			break
+		}
+	}
+	signing := private[signingIdx]
+
+	active := make([]*signingKey, 0, len(keys))
+	for _, key := range keys {
+		if key.private == nil {
+			active = append(active, key)
+		}
+	}
+	for i, key := range private {
+		if i <= signingIdx {
+			active = append(active, key)
+			continue
+		}
+		// Ключ перестал подписывать, когда начал подписывать следующий за ним по времени.
+		retiredAt := private[i-1].createdAt.Add(keyPublishDelay)
+		if now.Before(retiredAt.Add(r.cfg.RetainFor)) {
+			active = append(active, key)
+			continue
+		}
+		if strings.HasPrefix(filepath.Base(key.file), generatedKeyPrefix) {
+			if err := os.Remove(key.file); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("failed to remove retired jwt key %s: %v", key.file, err)
+			}
+		}
+	}
+	return signing, active
+}
+
+// load читает все *.pem из каталога. Файлы, которые не удалось разобрать, пропускаются
+// с записью в лог, чтобы один испорченный ключ не останавливал сервис.
+func (r *KeyRing) load() ([]*signingKey, error) {
+	files, err := filepath.Glob(filepath.Join(r.cfg.Dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*signingKey, 0, len(files))
+	seen := make(map[string]bool, len(files))
+	for _, file := range files {
+		key, err := loadKeyFile(file)
+		if err != nil {
+			log.Printf("skipping jwt key %s: %v", file, err)
+			continue
+		}
+		if seen[key.id] {
+			continue
+		}
+		seen[key.id] = true
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// generate создает новый закрытый ключ и сохраняет его в каталог.
+func (r *KeyRing) generate() (*signingKey, error) {
+	var private crypto.Signer
+	switch r.cfg.Algorithm {
+	case AlgorithmRS256:
+		key, err := rsa.GenerateKey(rand.Reader, minRSAKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	case AlgorithmEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	key, err := newSigningKey(private, private.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	// Пишем через временный файл, чтобы другой экземпляр не прочитал ключ наполовину.
+	key.file = filepath.Join(r.cfg.Dir, fmt.Sprintf("%s%d-%s.pem", generatedKeyPrefix, time.Now().Unix(), key.id[:8]))
+	tmp, err := os.CreateTemp(r.cfg.Dir, ".tmp-jwt-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if err := pem.Encode(tmp, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), key.file); err != nil {
+		return nil, err
+	}
+
+	key.createdAt = time.Now()
+	log.Printf("generated new jwt signing key %s", key.id)
+	return key, nil
+}
+
+// sign подписывает токен текущим ключом и указывает его kid в заголовке.
+func (r *KeyRing) sign(claims jwt.Claims) (string, error) {
+	r.mu.RLock()
+	key := r.signing
+	r.mu.RUnlock()
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.algorithm), claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.private)
+}
+
+// keyFunc выбирает ключ проверки по kid и алгоритму из заголовка токена.
+func (r *KeyRing) keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		return r.legacyKey(token)
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	r.mu.RLock()
+	key, ok := r.keys[kid]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.algorithm {
+		return nil, fmt.Errorf("key %q does not use %s", kid, token.Method.Alg())
+	}
+	return key.public, nil
+}
+
+// legacyKey возвращает общий секрет для токена HS256, выпущенного до перехода на
+// асимметричные ключи. Токены, выпущенные позже, подделаны: сервис их больше не подписывает.
+func (r *KeyRing) legacyKey(token *jwt.Token) (interface{}, error) {
+	if r.cfg.LegacySecret == "" || !time.Now().Before(r.cfg.LegacyIssuedBefore.Add(r.cfg.RetainFor)) {
+		return nil, errors.New("symmetric tokens are not accepted")
+	}
+	issuedAt, err := token.Claims.GetIssuedAt()
+	if err != nil || issuedAt == nil || !issuedAt.Before(r.cfg.LegacyIssuedBefore) {
+		return nil, errors.New("symmetric token is issued after the legacy secret was retired")
+	}
+	return []byte(r.cfg.LegacySecret), nil
+}
+
+// validMethods возвращает алгоритмы, которые принимаются при проверке токенов.
+func (r *KeyRing) validMethods() []string {
+	methods := []string{AlgorithmRS256, AlgorithmEdDSA}
+	if r.cfg.LegacySecret != "" {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	return methods
+}
+
+// JWK - открытый ключ в формате JSON Web Key (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS возвращает открытые ключи, которыми проверяются access-токены.
+// Общий секрет HS256 сюда, разумеется, не попадает.
+func (r *KeyRing) JWKS() []JWK {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	jwks := make([]JWK, 0, len(r.keys))
+	for _, key := range r.keys {
+		jwk := publicJWK(key.public)
+		jwk.Kid = key.id
+		jwk.Use = "sig"
+		jwk.Alg = key.algorithm
+		jwks = append(jwks, jwk)
+	}
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].Kid < jwks[j].Kid })
+	return jwks
+}
+
+func loadKeyFile(file string) (*signingKey, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var (
+		private crypto.Signer
+		public  crypto.PublicKey
+	)
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key")
+		}
+		private, public = signer, signer.Public()
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		private, public = key, key.Public()
+	case "PUBLIC KEY":
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+
+	key, err := newSigningKey(private, public)
+	if err != nil {
+		return nil, err
+	}
+	key.file = file
+	key.createdAt = info.ModTime()
+	return key, nil
+}
+
+// newSigningKey определяет алгоритм ключа и вычисляет его kid.
+func newSigningKey(private crypto.Signer, public crypto.PublicKey) (*signingKey, error) {
+	key := &signingKey{private: private, public: public}
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key is shorter than %d bits", minRSAKeyBits)
+		}
+		key.algorithm = AlgorithmRS256
+	case ed25519.PublicKey:
+		key.algorithm = AlgorithmEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", public)
+	}
+	key.id = thumbprint(public)
+	return key, nil
+}
+
+// thumbprint вычисляет отпечаток ключа по RFC 7638. Он служит kid: одинаковый ключ
+// получает одинаковый kid на всех экземплярах, как бы ни назывался его файл.
+func thumbprint(public crypto.PublicKey) string {
+	jwk := publicJWK(public)
+	// Обязательные поля в лексикографическом порядке, без пробелов.
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func publicJWK(public crypto.PublicKey) JWK {
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(pub)}
+	}
+	return JWK{}
+}
+
+func newestPrivate(keys []*signingKey) *signingKey {
+	var newest *signingKey
+	for _, key := range keys {
+		if key.private != nil && (newest == nil || key.createdAt.After(newest.createdAt)) {
+			newest = key
+		}
+	}
+	return newest
+}
@@ -0,0 +1,301 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeKey сохраняет новый закрытый ключ Ed25519 в файл name, созданный age назад, и возвращает его kid.
+func writeKey(t *testing.T, dir, name string, age time.Duration) string {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	setAge(t, file, age)
+	return thumbprint(private.Public())
+}
+
+func setAge(t *testing.T, file string, age time.Duration) {
+	t.Helper()
+	modTime := time.Now().Add(-age)
+	if err := os.Chtimes(file, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func signingKid(r *KeyRing) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.signing.id
+}
+
+func hasKey(r *KeyRing, kid string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.keys[kid]
+	return ok
+}
+
+func TestKeyRingSignsWithNewKeyAfterPublishDelay(t *testing.T) {
+	dir := t.TempDir()
+	old := writeKey(t, dir, "jwt-old.pem", time.Hour)
+
+	r, err := NewKeyRing(KeyRingConfig{Dir: dir, Algorithm: AlgorithmEdDSA, RotationInterval: 30 * time.Minute, RetainFor: time.Hour})
+	if err != nil {
+		t.Fatalf("NewKeyRing: %v", err)
+	}
+	if len(r.JWKS()) != 2 {
+		t.Fatalf("JWKS has %d keys, want the old and the rotated one", len(r.JWKS()))
+	}
+	// Новый ключ уже опубликован, но подписывает по-прежнему старый.
+	if got := signingKid(r); got != old {
+		t.Fatalf("signing kid = %q, want the old key %q", got, old)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, generatedKeyPrefix+"*.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if filepath.Base(file) != "jwt-old.pem" {
+			setAge(t, file, keyPublishDelay)
+		}
+	}
+	if err := r.refresh(); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if got := signingKid(r); got == old {
+		t.Fatal("rotated key does not sign after the publish delay")
+	}
+	if !hasKey(r, old) {
+		t.Fatal("old key was dropped before RetainFor passed")
+	}
+}
+
+func TestKeyRingRetainsReplacedKey(t *testing.T) {
+	dir := t.TempDir()
+	retainFor := time.Hour
+	old := writeKey(t, dir, "jwt-old.pem", 3*time.Hour)
+	admin := writeKey(t, dir, "admin.pem", 4*time.Hour)
+	current := writeKey(t, dir, "jwt-current.pem", 30*time.Minute)
+
+	r, err := NewKeyRing(KeyRingConfig{Dir: dir, Algorithm: AlgorithmEdDSA, RetainFor: retainFor})
+	if err != nil {
+		t.Fatalf("NewKeyRing: %v", err)
+	}
+	if got := signingKid(r); got != current {
+		t.Fatalf("signing kid = %q, want %q", got, current)
+	}
+	// old сменился 20 минут назад и еще принимается. admin сменил old 2 ч 50 мин назад.
+	if !hasKey(r, old) {
+		t.Fatal("replaced key is dropped before RetainFor passed")
+	}
+	if hasKey(r, admin) {
+		t.Fatal("key replaced long ago is still accepted")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "admin.pem")); err != nil {
+		t.Fatalf("key not created by the service was removed: %v", err)
+	}
+
+	// Теперь ключ current подписывает дольше RetainFor.
+	setAge(t, filepath.Join(dir, "jwt-current.pem"), keyPublishDelay+retainFor+time.Minute)
+	if err := r.refresh(); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if hasKey(r, old) {
+		t.Fatal("replaced key is still accepted after RetainFor")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "jwt-old.pem")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("retired generated key was not removed: %v", err)
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	decode := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	tests := []struct {
+		name string
+		key  crypto.PublicKey
+		want string
+	}{
+		{
+			// RFC 7638, раздел 3.1.
+			name: "RSA",
+			key: &rsa.PublicKey{
+				N: new(big.Int).SetBytes(decode("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")),
+				E: 65537,
+			},
+			want: "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs",
+		},
+		{
+			// RFC 8037, приложение A.3.
+			name: "Ed25519",
+			key:  ed25519.PublicKey(decode("11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo")),
+			want: "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := thumbprint(tt.key); got != tt.want {
+				t.Errorf("thumbprint = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyRingKidIsThumbprint(t *testing.T) {
+	dir := t.TempDir()
+	kid := writeKey(t, dir, "any-name.pem", time.Hour)
+
+	r, err := NewKeyRing(KeyRingConfig{Dir: dir, Algorithm: AlgorithmEdDSA})
+	if err != nil {
+		t.Fatalf("NewKeyRing: %v", err)
+	}
+	raw, err := r.sign(jwt.RegisteredClaims{Subject: "1"})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	token, err := jwt.Parse(raw, r.keyFunc, jwt.WithValidMethods(r.validMethods()))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got := token.Header["kid"]; got != kid {
+		t.Fatalf("kid = %v, want %q", got, kid)
+	}
+}
+
+// legacyToken подписывает общим секретом токен, выпущенный в issuedAt.
+func legacyToken(t *testing.T, issuedAt time.Time) string {
+	t.Helper()
+	claims := jwt.RegisteredClaims{Subject: "1", IssuedAt: jwt.NewNumericDate(issuedAt)}
+	raw, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("legacy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestKeyRingSymmetricTokens(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "jwt-key.pem", time.Hour)
+	retiredAt := time.Now().Add(-time.Minute)
+	raw := legacyToken(t, retiredAt.Add(-time.Minute))
+
+	r, err := NewKeyRing(KeyRingConfig{Dir: dir, Algorithm: AlgorithmEdDSA})
+	if err != nil {
+		t.Fatalf("NewKeyRing: %v", err)
+	}
+	if _, err := jwt.Parse(raw, r.keyFunc, jwt.WithValidMethods(r.validMethods())); err == nil {
+		t.Fatal("HS256 token accepted without a legacy secret")
+	}
+	// Даже если список алгоритмов не ограничен, keyFunc не вернет ключ HMAC.
+	if _, err := jwt.Parse(raw, r.keyFunc); err == nil {
+		t.Fatal("keyFunc accepted an HS256 token without a legacy secret")
+	}
+
+	if _, err := NewKeyRing(KeyRingConfig{Dir: dir, Algorithm: AlgorithmEdDSA, LegacySecret: "legacy"}); err == nil {
+		t.Fatal("legacy secret accepted without the time it was retired")
+	}
+
+	r, err = NewKeyRing(KeyRingConfig{
+		Dir:                dir,
+		Algorithm:          AlgorithmEdDSA,
+		RetainFor:          15 * time.Minute,
+		LegacySecret:       "legacy",
+		LegacyIssuedBefore: retiredAt,
+	})
+	if err != nil {
+		t.Fatalf("NewKeyRing: %v", err)
+	}
+	if _, err := jwt.Parse(raw, r.keyFunc, jwt.WithValidMethods(r.validMethods())); err != nil {
+		t.Fatalf("HS256 token issued before the cutoff rejected: %v", err)
+	}
+}
+
+func TestKeyRingRejectsLegacyTokensAfterCutoff(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "jwt-key.pem", time.Hour)
+	cfg := KeyRingConfig{
+		Dir:                dir,
+		Algorithm:          AlgorithmEdDSA,
+		RetainFor:          15 * time.Minute,
+		LegacySecret:       "legacy",
+		LegacyIssuedBefore: time.Now().Add(-time.Minute),
+	}
+	r, err := NewKeyRing(cfg)
+	if err != nil {
+		t.Fatalf("NewKeyRing: %v", err)
+	}
+
+	// Сервис больше не подписывает HS256, так что такой токен подделан знающим секрет.
+	forged := legacyToken(t, time.Now())
+	if _, err := jwt.Parse(forged, r.keyFunc, jwt.WithValidMethods(r.validMethods())); err == nil {
+		t.Fatal("HS256 token issued after the cutoff accepted")
+	}
+	noIAT, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "1"}).SignedString([]byte("legacy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwt.Parse(noIAT, r.keyFunc, jwt.WithValidMethods(r.validMethods())); err == nil {
+		t.Fatal("HS256 token without iat accepted")
+	}
+
+	// Спустя RetainFor после перехода все честные токены HS256 истекли, и секрет не принимается вовсе.
+	cfg.LegacyIssuedBefore = time.Now().Add(-cfg.RetainFor - time.Minute)
+	r, err = NewKeyRing(cfg)
+	if err != nil {
+		t.Fatalf("NewKeyRing: %v", err)
+	}
+	old := legacyToken(t, cfg.LegacyIssuedBefore.Add(-time.Minute))
+	if _, err := jwt.Parse(old, r.keyFunc, jwt.WithValidMethods(r.validMethods())); err == nil {
+		t.Fatal("HS256 token accepted after the legacy secret expired")
+	}
+}
+
+func TestKeyRingRejectsAlgorithmMismatch(t *testing.T) {
+	dir := t.TempDir()
+	kid := writeKey(t, dir, "jwt-key.pem", time.Hour)
+	r, err := NewKeyRing(KeyRingConfig{Dir: dir, Algorithm: AlgorithmEdDSA})
+	if err != nil {
+		t.Fatalf("NewKeyRing: %v", err)
+	}
+
+	// Токен ссылается на ключ Ed25519, но заявляет RS256.
+	token := &jwt.Token{Method: jwt.SigningMethodRS256, Header: map[string]interface{}{"alg": "RS256", "kid": kid}}
+	if _, err := r.keyFunc(token); err == nil {
+		t.Fatal("keyFunc returned a key for a mismatched algorithm")
+	}
+
+	token = &jwt.Token{Method: jwt.SigningMethodEdDSA, Header: map[string]interface{}{"alg": "EdDSA", "kid": "unknown"}}
+	if _, err := r.keyFunc(token); err == nil {
+		t.Fatal("keyFunc returned a key for an unknown kid")
+	}
+}
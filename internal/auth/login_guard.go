@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"go-chat/internal/domain"
+	"go-chat/internal/repository"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidCredentials означает, что адрес не зарегистрирован или пароль не подошел.
+// Какой из случаев произошел, намеренно не различается.
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+// Самая долгая блокировка адреса после серии неудачных входов.
+const maxLockout = 24 * time.Hour
+
+// dummyPasswordHash сравнивается с паролем, когда адрес не зарегистрирован, чтобы ответ
+// занимал столько же времени, сколько проверка настоящего пароля. Стоимость совпадает
+// с той, что используется при регистрации.
+var dummyPasswordHash = sync.OnceValues(func() ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte("go-chat dummy password"), bcrypt.DefaultCost)
+})
+
+// ThrottledError означает, что вход временно запрещен из-за неудачных попыток.
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return "too many failed login attempts"
+}
+
+// LoginGuardConfig - параметры защиты от подбора пароля.
+type LoginGuardConfig struct {
+	// MaxFailures - число неудач подряд для одного адреса, после которого он блокируется
+	// на Lockout. Каждая следующая неудача удваивает блокировку.
+	MaxFailures int
+	// Backoff - задержка после первой неудачи. До блокировки задержка удваивается
+	// с каждой неудачей.
+	Backoff time.Duration
+	Lockout time.Duration
+	// FailureWindow - через сколько после последней неудачи счетчик адреса начинается заново.
+	FailureWindow time.Duration
+	// IPMaxFailures - число неудач с одного IP, после которого он блокируется на Lockout.
+	IPMaxFailures int
+	// IPWindow - через сколько после последней неудачи счетчик IP начинается заново.
+	IPWindow time.Duration
+}
+
+// LoginGuard проверяет пароль при входе, ограничивая число попыток по адресу и по IP.
+type LoginGuard struct {
+	repo  repository.LoginThrottleRepository
+	users repository.UserRepository
+	cfg   LoginGuardConfig
+}
+
+func NewLoginGuard(repo repository.LoginThrottleRepository, users repository.UserRepository, cfg LoginGuardConfig) *LoginGuard {
+	// Хэш считается заранее, иначе первый вход с неизвестным адресом был бы медленнее.
+	dummyPasswordHash()
+	return &LoginGuard{repo: repo, users: users, cfg: cfg}
+}
+
+// Authenticate проверяет адрес и пароль. Возвращает ErrInvalidCredentials, если они
+// не подошли, и *ThrottledError, если попытки временно запрещены.
+func (g *LoginGuard) Authenticate(ctx context.Context, email, password string, device Device) (*domain.User, error) {
+	emailKey := "email:" + strings.ToLower(strings.TrimSpace(email))
+	keys := []string{emailKey}
+	if device.IP != "" {
+		keys = append(keys, "ip:"+device.IP)
+	}
+
+	// Пароль в этом случае не проверяется, поэтому счетчики не растут.
+	if err := g.checkLocked(ctx, keys, email, nil, device); err != nil {
+		return nil, err
+	}
+
+	user, err := g.users.GetByEmail(ctx, email)
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+		return nil, err
+	}
+
+	hash, err := dummyPasswordHash()
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		hash = []byte(user.PasswordHash)
+	}
+	passwordErr := bcrypt.CompareHashAndPassword(hash, []byte(password))
+
+	switch {
+	case user == nil:
+		return nil, g.fail(ctx, emailKey, email, nil, device, domain.LoginFailureUnknownEmail)
+	case passwordErr != nil:
+		return nil, g.fail(ctx, emailKey, email, &user.ID, device, domain.LoginFailureWrongPassword)
+	}
+
+	if err := g.repo.Reset(ctx, emailKey); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// CheckTwoFactor возвращает *ThrottledError, если пользователю временно запрещено
+// вводить код второго фактора.
+func (g *LoginGuard) CheckTwoFactor(ctx context.Context, user *domain.User, device Device) error {
+	keys := []string{twoFactorKey(user.ID)}
+	if device.IP != "" {
+		keys = append(keys, "ip:"+device.IP)
+	}
+	return g.checkLocked(ctx, keys, user.Email, &user.ID, device)
+}
+
+// TwoFactorFailed учитывает неверный код второго фактора так же, как неверный пароль,
+// и возвращает ErrInvalidCode.
+func (g *LoginGuard) TwoFactorFailed(ctx context.Context, user *domain.User, device Device) error {
+	err := g.fail(ctx, twoFactorKey(user.ID), user.Email, &user.ID, device, domain.LoginFailureWrongCode)
+	if !errors.Is(err, ErrInvalidCredentials) {
+		return err
+	}
+	return ErrInvalidCode
+}
+
+// TwoFactorSucceeded сбрасывает счетчик неверных кодов после успешного входа.
+func (g *LoginGuard) TwoFactorSucceeded(ctx context.Context, userID int64) error {
+	return g.repo.Reset(ctx, twoFactorKey(userID))
+}
+
+// twoFactorKey - ключ счетчика неверных кодов второго фактора. Он отделен от счетчика
+// адреса, который сбрасывает успешный вход по паролю: иначе знающий пароль получал бы
+// новые попытки подобрать код после каждого входа.
+func twoFactorKey(userID int64) string {
+	return "mfa:" + strconv.FormatInt(userID, 10)
+}
+
+// checkLocked возвращает *ThrottledError и пишет в журнал, если хотя бы один из ключей заблокирован.
+func (g *LoginGuard) checkLocked(ctx context.Context, keys []string, email string, userID *int64, device Device) error {
+	lockedUntil, err := g.repo.LockedUntil(ctx, keys)
+	if err != nil {
+		return err
+	}
+	wait := time.Until(lockedUntil)
+	if wait <= 0 {
+		return nil
+	}
+	if err := g.log(ctx, email, userID, device, domain.LoginFailureThrottled); err != nil {
+		return err
+	}
+	return &ThrottledError{RetryAfter: wait}
+}
+
+// fail учитывает неудачную попытку по ключу key (адресу или второму фактору пользователя)
+// и возвращает ErrInvalidCredentials. Неизвестный адрес и неверный пароль выполняют
+// одни и те же запросы.
+func (g *LoginGuard) fail(ctx context.Context, key, email string, userID *int64, device Device, reason string) error {
+	failures, err := g.repo.RecordFailure(ctx, key, g.cfg.FailureWindow)
+	if err != nil {
+		return err
+	}
+	if wait := g.emailDelay(failures); wait > 0 {
+		if err := g.repo.Lock(ctx, key, time.Now().Add(wait)); err != nil {
+			return err
+		}
+	}
+
+	if device.IP != "" {
+		ipKey := "ip:" + device.IP
+		failures, err := g.repo.RecordFailure(ctx, ipKey, g.cfg.IPWindow)
+		if err != nil {
+			return err
+		}
+		if g.cfg.IPMaxFailures > 0 && failures >= g.cfg.IPMaxFailures {
+			if err := g.repo.Lock(ctx, ipKey, time.Now().Add(g.cfg.Lockout)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := g.log(ctx, email, userID, device, reason); err != nil {
+		return err
+	}
+	return ErrInvalidCredentials
+}
+
+// emailDelay возвращает, на сколько заблокировать адрес после failures неудач подряд.
+func (g *LoginGuard) emailDelay(failures int) time.Duration {
+	if g.cfg.MaxFailures <= 0 || failures < g.cfg.MaxFailures {
+		if g.cfg.Backoff <= 0 {
+			return 0
+		}
+		return min(g.cfg.Backoff<<min(failures-1, 16), g.cfg.Lockout)
+	}
+	return min(g.cfg.Lockout<<min(failures-g.cfg.MaxFailures, 16), maxLockout)
+}
+
+func (g *LoginGuard) log(ctx context.Context, email string, userID *int64, device Device, reason string) error {
+	return g.repo.LogFailure(ctx, &domain.FailedLogin{
+		Email:     email,
+		UserID:    userID,
+		IP:        device.IP,
+		UserAgent: device.userAgent(),
+		Reason:    reason,
+	})
+}
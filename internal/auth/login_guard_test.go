@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-chat/internal/domain"
+	"go-chat/internal/repository"
+	"go-chat/internal/totp"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeThrottleRepo хранит счетчики и журнал неудачных входов в памяти.
+type fakeThrottleRepo struct {
+	failures map[string]int
+	locked   map[string]time.Time
+	log      []domain.FailedLogin
+}
+
+func newFakeThrottleRepo() *fakeThrottleRepo {
+	return &fakeThrottleRepo{failures: map[string]int{}, locked: map[string]time.Time{}}
+}
+
+func (f *fakeThrottleRepo) LockedUntil(ctx context.Context, keys []string) (time.Time, error) {
+	var until time.Time
+	for _, key := range keys {
+		if t := f.locked[key]; t.After(time.Now()) && t.After(until) {
+			until = t
+		}
+	}
+	return until, nil
+}
+
+func (f *fakeThrottleRepo) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	f.failures[key]++
+	return f.failures[key], nil
+}
+
+func (f *fakeThrottleRepo) Lock(ctx context.Context, key string, until time.Time) error {
+	f.locked[key] = until
+	return nil
+}
+
+func (f *fakeThrottleRepo) Reset(ctx context.Context, key string) error {
+	delete(f.failures, key)
+	delete(f.locked, key)
+	return nil
+}
+
+func (f *fakeThrottleRepo) LogFailure(ctx context.Context, failure *domain.FailedLogin) error {
+	f.log = append(f.log, *failure)
+	return nil
+}
+
+type fakeUserRepo struct {
+	repository.UserRepository
+	user *domain.User
+}
+
+func (f *fakeUserRepo) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	if email != f.user.Email {
+		return nil, repository.ErrUserNotFound
+	}
+	return f.user, nil
+}
+
+func (f *fakeUserRepo) GetByID(ctx context.Context, id int64) (*domain.User, error) {
+	if id != f.user.ID {
+		return nil, repository.ErrUserNotFound
+	}
+	return f.user, nil
+}
+
+func TestTwoFactorFailuresSurvivePasswordLogin(t *testing.T) {
+	ctx := context.Background()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &fakeUserRepo{user: &domain.User{ID: 1, Email: "alice@example.com", PasswordHash: string(hash)}}
+	throttle := newFakeThrottleRepo()
+	guard := NewLoginGuard(throttle, users, LoginGuardConfig{
+		MaxFailures:   3,
+		Lockout:       time.Minute,
+		FailureWindow: time.Hour,
+	})
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirmed := time.Now()
+	twoFactorRepo := &fakeTwoFactorRepo{tf: &domain.TwoFactor{UserID: 1, Secret: secret, ConfirmedAt: &confirmed}}
+	s := NewTwoFactorService(twoFactorRepo, users, nil, guard, "go-chat", time.Minute)
+	device := Device{IP: "203.0.113.7"}
+
+	// Каждый неверный код идет после нового входа по паролю, который сбрасывает
+	// счетчик адреса, но не счетчик второго фактора.
+	for i := range 3 {
+		if _, err := guard.Authenticate(ctx, "alice@example.com", "secret", device); err != nil {
+			t.Fatalf("attempt %d: Authenticate: %v", i, err)
+		}
+		if _, err := s.Verify(ctx, "challenge", "000000", device); !errors.Is(err, ErrInvalidCode) {
+			t.Fatalf("attempt %d: Verify err = %v, want ErrInvalidCode", i, err)
+		}
+	}
+
+	if _, err := guard.Authenticate(ctx, "alice@example.com", "secret", device); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	var throttled *ThrottledError
+	if _, err := s.Verify(ctx, "challenge", "000000", device); !errors.As(err, &throttled) {
+		t.Fatalf("Verify after %d wrong codes: err = %v, want *ThrottledError", 3, err)
+	}
+
+	var wrongCodes int
+	for _, entry := range throttle.log {
+		if entry.Reason == domain.LoginFailureWrongCode {
+			wrongCodes++
+			if entry.UserID == nil || *entry.UserID != 1 || entry.Email != "alice@example.com" || entry.IP != device.IP {
+				t.Errorf("unexpected audit entry %+v", entry)
+			}
+		}
+	}
+	if wrongCodes != 3 {
+		t.Errorf("logged %d wrong codes, want 3", wrongCodes)
+	}
+}
+
+func TestEmailDelay(t *testing.T) {
+	g := &LoginGuard{cfg: LoginGuardConfig{MaxFailures: 5, Backoff: time.Second, Lockout: 15 * time.Minute}}
+	want := []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second,
+		15 * time.Minute, 30 * time.Minute, time.Hour,
+	}
+	for i, w := range want {
+		if got := g.emailDelay(i + 1); got != w {
+			t.Errorf("emailDelay(%d) = %s, want %s", i+1, got, w)
+		}
+	}
+	if got := g.emailDelay(100); got != maxLockout {
+		t.Errorf("emailDelay(100) = %s, want %s", got, maxLockout)
+	}
+}
@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"go-chat/internal/domain"
+	"go-chat/internal/oidc"
+	"go-chat/internal/repository"
+	"math/big"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrSSOEmailNotVerified означает, что провайдер не подтвердил адрес пользователя,
+	// поэтому по нему нельзя ни найти, ни создать аккаунт.
+	ErrSSOEmailNotVerified = errors.New("identity provider did not return a verified email")
+	// ErrSSOUserNotFound означает, что аккаунта с таким адресом нет, а автоматическое
+	// создание аккаунтов выключено.
+	ErrSSOUserNotFound = errors.New("no user with this email")
+	// ErrSSOAccountNotVerified означает, что аккаунт с таким адресом есть, но владение
+	// адресом в нем не подтверждено. Такой аккаунт мог зарегистрировать кто угодно,
+	// поэтому он не привязывается к провайдеру автоматически.
+	ErrSSOAccountNotVerified = errors.New("existing account has an unverified email")
+)
+
+// SSOLoginTTL - сколько ждать возврата пользователя от провайдера.
+const SSOLoginTTL = 10 * time.Minute
+
+const (
+	// Сколько имен пробовать при создании аккаунта, если желаемое занято.
+	usernameAttempts  = 5
+	maxUsernameLength = 32
+)
+
+// SSOService выполняет вход через провайдера OpenID Connect.
+type SSOService struct {
+	provider      *oidc.Provider
+	identities    repository.IdentityRepository
+	users         repository.UserRepository
+	autoProvision bool
+}
+
+// NewSSOService создает сервис входа через провайдера. Если autoProvision включен,
+// пользователь с новым адресом получает аккаунт при первом входе.
+func NewSSOService(provider *oidc.Provider, identities repository.IdentityRepository, users repository.UserRepository, autoProvision bool) *SSOService {
+	return &SSOService{provider: provider, identities: identities, users: users, autoProvision: autoProvision}
+}
+
+// Begin начинает вход: возвращает state, который нужно сверить при возврате, и адрес
+// страницы входа провайдера.
+func (s *SSOService) Begin(ctx context.Context) (state, authURL string, err error) {
+	state, err = oidc.RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := oidc.RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	codeVerifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err = s.provider.AuthCodeURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.identities.SaveLogin(ctx, hashToken(state), nonce, codeVerifier, time.Now().Add(SSOLoginTTL)); err != nil {
+		return "", "", err
+	}
+	return state, authURL, nil
+}
+
+// Complete завершает вход по коду от провайдера и возвращает пользователя: привязанного
+// к учетной записи провайдера, найденного по подтвержденному адресу или созданного.
+func (s *SSOService) Complete(ctx context.Context, state, code string) (*domain.User, error) {
+	nonce, codeVerifier, err := s.identities.ConsumeLogin(ctx, hashToken(state))
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := s.provider.Exchange(ctx, code, codeVerifier, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.identities.GetUser(ctx, claims.Issuer, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, repository.ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	if claims.Email == "" || !bool(claims.EmailVerified) {
+		return nil, ErrSSOEmailNotVerified
+	}
+
+	user, err = s.users.GetByEmail(ctx, claims.Email)
+	if err == nil {
+		return s.link(ctx, user, claims)
+	}
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		return nil, err
+	}
+	if !s.autoProvision {
+		return nil, ErrSSOUserNotFound
+	}
+
+	return s.provision(ctx, claims)
+}
+
+// link привязывает учетную запись провайдера к существующему аккаунту с тем же адресом.
+// Аккаунт с неподтвержденным адресом не привязывается: иначе злоумышленник мог бы заранее
+// зарегистрировать чужой адрес со своим паролем и получить доступ к аккаунту, в который
+// владелец адреса позже войдет через провайдера.
+func (s *SSOService) link(ctx context.Context, user *domain.User, claims *oidc.Claims) (*domain.User, error) {
+	if !user.IsEmailVerified() {
+		return nil, ErrSSOAccountNotVerified
+	}
+	if err := s.identities.Link(ctx, user.ID, claims.Issuer, claims.Subject); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// provision создает аккаунт для пользователя провайдера. Пароля у аккаунта нет:
+// в password_hash записывается хэш случайной строки, а задать пароль можно через сброс.
+func (s *SSOService) provision(ctx context.Context, claims *oidc.Claims) (*domain.User, error) {
+	password, err := oidc.RandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	base := usernameFromClaims(claims)
+	for attempt := 0; attempt < usernameAttempts; attempt++ {
+		username := base
+		if attempt > 0 {
+			suffix, err := rand.Int(rand.Reader, big.NewInt(10000))
+			if err != nil {
+				return nil, err
+			}
+			username = fmt.Sprintf("%s-%04d", base[:min(len(base), maxUsernameLength-5)], suffix)
+		}
+
+		user := &domain.User{Username: username, Email: claims.Email, PasswordHash: string(passwordHash)}
+		err := s.identities.CreateUser(ctx, user, claims.Issuer, claims.Subject)
+		if errors.Is(err, repository.ErrUsernameTaken) {
+			continue
+		}
+		if errors.Is(err, repository.ErrEmailTaken) {
+			// Аккаунт с этим адресом появился параллельно - привязываемся к нему.
+			existing, err := s.users.GetByEmail(ctx, claims.Email)
+			if err != nil {
+				return nil, err
+			}
+			return s.link(ctx, existing, claims)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+	return nil, repository.ErrUsernameTaken
+}
+
+// usernameFromClaims выбирает имя для нового аккаунта: preferred_username или часть адреса до @.
+func usernameFromClaims(claims *oidc.Claims) string {
+	name := claims.PreferredUsername
+	if at := strings.IndexByte(name, '@'); at >= 0 {
+		name = name[:at]
+	}
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+			b.WriteRune(r)
+		}
+		if b.Len() == maxUsernameLength {
+			break
+		}
+	}
+	username := b.String()
+	if len(username) < 3 {
+		username = "user" + username
+	}
+	return username
+}
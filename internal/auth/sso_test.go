@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"go-chat/internal/domain"
+	"go-chat/internal/oidc"
+	"go-chat/internal/oidc/oidctest"
+	"go-chat/internal/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type fakeLogin struct {
+	nonce, codeVerifier string
+}
+
+type fakeIdentityRepo struct {
+	repository.IdentityRepository
+	logins  map[string]fakeLogin
+	links   map[string]*domain.User
+	created []*domain.User
+}
+
+func newFakeIdentityRepo() *fakeIdentityRepo {
+	return &fakeIdentityRepo{logins: make(map[string]fakeLogin), links: make(map[string]*domain.User)}
+}
+
+func (f *fakeIdentityRepo) SaveLogin(ctx context.Context, stateHash []byte, nonce, codeVerifier string, expiresAt time.Time) error {
+	f.logins[string(stateHash)] = fakeLogin{nonce: nonce, codeVerifier: codeVerifier}
+	return nil
+}
+
+func (f *fakeIdentityRepo) ConsumeLogin(ctx context.Context, stateHash []byte) (string, string, error) {
+	login, ok := f.logins[string(stateHash)]
+	if !ok {
+		return "", "", repository.ErrOIDCLoginInvalid
+	}
+	delete(f.logins, string(stateHash))
+	return login.nonce, login.codeVerifier, nil
+}
+
+func (f *fakeIdentityRepo) GetUser(ctx context.Context, issuer, subject string) (*domain.User, error) {
+	user, ok := f.links[issuer+" "+subject]
+	if !ok {
+		return nil, repository.ErrIdentityNotFound
+	}
+	return user, nil
+}
+
+func (f *fakeIdentityRepo) Link(ctx context.Context, userID int64, issuer, subject string) error {
+	f.links[issuer+" "+subject] = &domain.User{ID: userID}
+	return nil
+}
+
+func (f *fakeIdentityRepo) CreateUser(ctx context.Context, user *domain.User, issuer, subject string) error {
+	now := time.Now()
+	user.ID = int64(100 + len(f.created))
+	user.EmailVerifiedAt = &now
+	f.created = append(f.created, user)
+	f.links[issuer+" "+subject] = user
+	return nil
+}
+
+// ssoLogin проходит вход целиком: Begin, вход на стороне провайдера с утверждениями,
+// которые заполняет modify, и Complete.
+func ssoLogin(t *testing.T, s *SSOService, issuer *oidctest.Issuer, modify func(claims jwt.MapClaims)) (*domain.User, error) {
+	t.Helper()
+	ctx := context.Background()
+	state, authURL, err := s.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := u.Query()
+	if params.Get("state") != state {
+		t.Fatalf("state in auth URL = %q, want %q", params.Get("state"), state)
+	}
+
+	claims := issuer.Claims("subject-1", params.Get("nonce"))
+	claims["email"] = "alice@example.com"
+	claims["email_verified"] = true
+	claims["preferred_username"] = "alice"
+	if modify != nil {
+		modify(claims)
+	}
+	code := issuer.Authorize(params.Get("code_challenge"), claims)
+	return s.Complete(ctx, state, code)
+}
+
+func newTestSSOService(t *testing.T, users repository.UserRepository, autoProvision bool) (*SSOService, *oidctest.Issuer, *fakeIdentityRepo) {
+	issuer := oidctest.NewIssuer(t, "go-chat")
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:     issuer.URL,
+		ClientID:   "go-chat",
+		Scopes:     []string{"openid", "email"},
+		HTTPClient: issuer.Client(),
+	})
+	identities := newFakeIdentityRepo()
+	return NewSSOService(provider, identities, users, autoProvision), issuer, identities
+}
+
+func TestSSOLinksVerifiedAccount(t *testing.T) {
+	verified := time.Now()
+	users := &fakeUserRepo{user: &domain.User{ID: 1, Email: "alice@example.com", EmailVerifiedAt: &verified}}
+	s, issuer, identities := newTestSSOService(t, users, true)
+
+	user, err := ssoLogin(t, s, issuer, nil)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if user.ID != 1 {
+		t.Fatalf("user ID = %d, want 1", user.ID)
+	}
+	if linked, ok := identities.links[issuer.URL+" subject-1"]; !ok || linked.ID != 1 {
+		t.Fatalf("identity is not linked to user 1: %v", identities.links)
+	}
+	if len(identities.created) != 0 {
+		t.Fatalf("created %d users, want 0", len(identities.created))
+	}
+
+	// Повторный вход находит пользователя по привязке, даже если адрес у провайдера сменился.
+	user, err = ssoLogin(t, s, issuer, func(c jwt.MapClaims) { c["email"] = "alice@new.example.com" })
+	if err != nil {
+		t.Fatalf("second Complete: %v", err)
+	}
+	if user.ID != 1 {
+		t.Fatalf("second login user ID = %d, want 1", user.ID)
+	}
+}
+
+func TestSSORefusesUnverifiedAccount(t *testing.T) {
+	// Аккаунт, зарегистрированный на чужой адрес без подтверждения.
+	users := &fakeUserRepo{user: &domain.User{ID: 1, Email: "alice@example.com"}}
+	s, issuer, identities := newTestSSOService(t, users, true)
+
+	if _, err := ssoLogin(t, s, issuer, nil); !errors.Is(err, ErrSSOAccountNotVerified) {
+		t.Fatalf("Complete err = %v, want ErrSSOAccountNotVerified", err)
+	}
+	if len(identities.links) != 0 {
+		t.Fatalf("identity was linked: %v", identities.links)
+	}
+}
+
+func TestSSORequiresVerifiedEmail(t *testing.T) {
+	users := &fakeUserRepo{user: &domain.User{ID: 1, Email: "bob@example.com"}}
+	tests := []struct {
+		name   string
+		modify func(claims jwt.MapClaims)
+	}{
+		{"false", func(c jwt.MapClaims) { c["email_verified"] = false }},
+		{"string false", func(c jwt.MapClaims) { c["email_verified"] = "false" }},
+		{"missing", func(c jwt.MapClaims) { delete(c, "email_verified") }},
+		{"no email", func(c jwt.MapClaims) { delete(c, "email") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, issuer, identities := newTestSSOService(t, users, true)
+			if _, err := ssoLogin(t, s, issuer, tt.modify); !errors.Is(err, ErrSSOEmailNotVerified) {
+				t.Fatalf("Complete err = %v, want ErrSSOEmailNotVerified", err)
+			}
+			if len(identities.created) != 0 || len(identities.links) != 0 {
+				t.Fatal("unverified email created or linked an account")
+			}
+		})
+	}
+}
+
+func TestSSOProvisionsNewUser(t *testing.T) {
+	users := &fakeUserRepo{user: &domain.User{ID: 1, Email: "bob@example.com"}}
+	s, issuer, identities := newTestSSOService(t, users, true)
+
+	user, err := ssoLogin(t, s, issuer, nil)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if len(identities.created) != 1 || identities.created[0] != user {
+		t.Fatalf("created = %v, want the returned user", identities.created)
+	}
+	if user.Username != "alice" || user.Email != "alice@example.com" || user.PasswordHash == "" {
+		t.Errorf("user = %+v", user)
+	}
+}
+
+func TestSSOWithoutProvisioning(t *testing.T) {
+	users := &fakeUserRepo{user: &domain.User{ID: 1, Email: "bob@example.com"}}
+	s, issuer, identities := newTestSSOService(t, users, false)
+
+	if _, err := ssoLogin(t, s, issuer, nil); !errors.Is(err, ErrSSOUserNotFound) {
+		t.Fatalf("Complete err = %v, want ErrSSOUserNotFound", err)
+	}
+	if len(identities.created) != 0 {
+		t.Fatal("user was created with provisioning disabled")
+	}
+}
+
+func TestSSOStateIsSingleUse(t *testing.T) {
+	verified := time.Now()
+	users := &fakeUserRepo{user: &domain.User{ID: 1, Email: "alice@example.com", EmailVerifiedAt: &verified}}
+	s, issuer, _ := newTestSSOService(t, users, true)
+	ctx := context.Background()
+
+	state, authURL, err := s.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	params := u.Query()
+	claims := issuer.Claims("subject-1", params.Get("nonce"))
+	claims["email"] = "alice@example.com"
+	claims["email_verified"] = true
+
+	code := issuer.Authorize(params.Get("code_challenge"), claims)
+	if _, err := s.Complete(ctx, state, code); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	code = issuer.Authorize(params.Get("code_challenge"), claims)
+	if _, err := s.Complete(ctx, state, code); !errors.Is(err, repository.ErrOIDCLoginInvalid) {
+		t.Fatalf("second Complete err = %v, want ErrOIDCLoginInvalid", err)
+	}
+}
@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"go-chat/internal/domain"
+	"go-chat/internal/repository"
+	"go-chat/internal/totp"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCode означает, что код из приложения или код восстановления не подошел.
+var ErrInvalidCode = errors.New("invalid two-factor code")
+
+const (
+	// Допустимое расхождение часов клиента и сервера в шагах TOTP.
+	totpSkew = 1
+	// Число попыток ввода кода на один вход.
+	maxChallengeAttempts = 5
+	// Число кодов восстановления, выдаваемых при подключении.
+	recoveryCodeCount = 10
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Enrollment - данные для подключения приложения-аутентификатора.
+type Enrollment struct {
+	Secret string `json:"secret"`
+	// URI - otpauth://-ссылка, которую клиент показывает в виде QR-кода.
+	URI string `json:"otpauth_uri"`
+}
+
+// Challenge - ответ на вход по паролю, когда нужен второй фактор.
+// Token обменивается на токены доступа вместе с кодом через TwoFactorService.Verify.
+type Challenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	Token       string `json:"mfa_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// TwoFactorService управляет вторым фактором входа (TOTP) и кодами восстановления.
+type TwoFactorService struct {
+	repo         repository.TwoFactorRepository
+	users        repository.UserRepository
+	auth         *Service
+	guard        *LoginGuard
+	issuer       string
+	challengeTTL time.Duration
+}
+
+func NewTwoFactorService(repo repository.TwoFactorRepository, users repository.UserRepository, authService *Service, guard *LoginGuard, issuer string, challengeTTL time.Duration) *TwoFactorService {
+	return &TwoFactorService{repo: repo, users: users, auth: authService, guard: guard, issuer: issuer, challengeTTL: challengeTTL}
+}
+
+// Enabled сообщает, нужен ли пользователю второй фактор при входе.
+func (s *TwoFactorService) Enabled(ctx context.Context, userID int64) (bool, error) {
+	tf, err := s.repo.Get(ctx, userID)
+	if errors.Is(err, repository.ErrTwoFactorNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return tf.IsConfirmed(), nil
+}
+
+// Enroll создает новый секрет. Второй фактор начинает действовать после Confirm.
+func (s *TwoFactorService) Enroll(ctx context.Context, user *domain.User) (*Enrollment, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SavePending(ctx, user.ID, secret); err != nil {
+		return nil, err
+	}
+	return &Enrollment{
+		Secret: totp.EncodeSecret(secret),
+		URI:    totp.ProvisioningURI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+// Confirm проверяет код из приложения, включает второй фактор и возвращает коды
+// восстановления. Коды показываются пользователю только один раз.
+func (s *TwoFactorService) Confirm(ctx context.Context, userID int64, code string) ([]string, error) {
+	tf, err := s.repo.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if tf.IsConfirmed() {
+		return nil, repository.ErrTwoFactorEnabled
+	}
+
+	step, ok := totp.Validate(tf.Secret, normalizeCode(code), time.Now(), totpSkew)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([][]byte, recoveryCodeCount)
+	for i := range codes {
+		codes[i], err = newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = hashToken(normalizeCode(codes[i]))
+	}
+
+	if err := s.repo.Confirm(ctx, userID, step, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable отключает второй фактор. Требует действующий код, чтобы его нельзя было
+// снять с украденной сессии. Неверные коды учитываются LoginGuard вместе с попытками
+// входа, иначе с украденным токеном доступа код можно было бы подбирать без ограничений.
+// Возвращает *ThrottledError, если попытки временно запрещены.
+func (s *TwoFactorService) Disable(ctx context.Context, userID int64, code string, device Device) error {
+	tf, err := s.repo.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if tf.IsConfirmed() {
+		user, err := s.users.GetByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if err := s.guard.CheckTwoFactor(ctx, user, device); err != nil {
+			return err
+		}
+		ok, err := s.checkCode(ctx, tf, code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return s.guard.TwoFactorFailed(ctx, user, device)
+		}
+		if err := s.guard.TwoFactorSucceeded(ctx, userID); err != nil {
+			return err
+		}
+	}
+	return s.repo.Delete(ctx, userID)
+}
+
+// Challenge начинает вход, ожидающий второго фактора. Пароль к этому моменту уже проверен.
+func (s *TwoFactorService) Challenge(ctx context.Context, user *domain.User) (*Challenge, error) {
+	token, tokenHash, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateChallenge(ctx, user.ID, tokenHash, time.Now().Add(s.challengeTTL)); err != nil {
+		return nil, err
+	}
+	return &Challenge{
+		MFARequired: true,
+		Token:       token,
+		ExpiresIn:   int64(s.challengeTTL / time.Second),
+	}, nil
+}
+
+// Verify завершает вход: проверяет код из приложения или код восстановления и создает сессию.
+// Неверные коды учитываются LoginGuard по пользователю, а не по входу, поэтому новый вход
+// по паролю не дает новых попыток. Возвращает *ThrottledError, если попытки временно запрещены.
+func (s *TwoFactorService) Verify(ctx context.Context, challengeToken, code string, device Device) (*Tokens, error) {
+	challengeHash := hashToken(challengeToken)
+	userID, err := s.repo.AttemptChallenge(ctx, challengeHash, maxChallengeAttempts)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.guard.CheckTwoFactor(ctx, user, device); err != nil {
+		return nil, err
+	}
+
+	tf, err := s.repo.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.checkCode(ctx, tf, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, s.guard.TwoFactorFailed(ctx, user, device)
+	}
+
+	if err := s.repo.CompleteChallenge(ctx, challengeHash); err != nil {
+		return nil, err
+	}
+	if err := s.guard.TwoFactorSucceeded(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.auth.StartSession(ctx, user, device)
+}
+
+// checkCode принимает код из приложения (каждый не более одного раза) или
+// неиспользованный код восстановления.
+func (s *TwoFactorService) checkCode(ctx context.Context, tf *domain.TwoFactor, code string) (bool, error) {
+	code = normalizeCode(code)
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(tf.Secret, code, time.Now(), totpSkew)
+		if !ok {
+			return false, nil
+		}
+		return s.repo.UseStep(ctx, tf.UserID, step)
+	}
+	return s.repo.UseRecoveryCode(ctx, tf.UserID, hashToken(code))
+}
+
+// newRecoveryCode генерирует код восстановления вида xxxx-xxxx-xxxx-xxxx (80 случайных бит).
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(recoveryEncoding.EncodeToString(b))
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16], nil
+}
+
+// normalizeCode убирает разделители, которые пользователь мог ввести или скопировать.
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+}
@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go-chat/internal/domain"
+	"go-chat/internal/repository"
+	"go-chat/internal/totp"
+)
+
+// fakeTwoFactorRepo хранит второй фактор одного пользователя в памяти и повторяет
+// правила pgx-реализации: шаг принимается, только если он новее последнего,
+// код восстановления - только один раз.
+type fakeTwoFactorRepo struct {
+	repository.TwoFactorRepository
+	tf       *domain.TwoFactor
+	recovery [][]byte
+}
+
+func (f *fakeTwoFactorRepo) Get(ctx context.Context, userID int64) (*domain.TwoFactor, error) {
+	if f.tf == nil || f.tf.UserID != userID {
+		return nil, repository.ErrTwoFactorNotFound
+	}
+	tf := *f.tf
+	return &tf, nil
+}
+
+func (f *fakeTwoFactorRepo) Confirm(ctx context.Context, userID, step int64, hashes [][]byte) error {
+	now := time.Now()
+	f.tf.ConfirmedAt = &now
+	f.tf.LastUsedStep = step
+	f.recovery = hashes
+	return nil
+}
+
+func (f *fakeTwoFactorRepo) UseStep(ctx context.Context, userID, step int64) (bool, error) {
+	if step <= f.tf.LastUsedStep {
+		return false, nil
+	}
+	f.tf.LastUsedStep = step
+	return true, nil
+}
+
+func (f *fakeTwoFactorRepo) UseRecoveryCode(ctx context.Context, userID int64, hash []byte) (bool, error) {
+	for i, h := range f.recovery {
+		if bytes.Equal(h, hash) {
+			f.recovery = append(f.recovery[:i], f.recovery[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// AttemptChallenge принимает любой токен: попытки в рамках одного входа здесь не важны.
+func (f *fakeTwoFactorRepo) AttemptChallenge(ctx context.Context, tokenHash []byte, maxAttempts int) (int64, error) {
+	return f.tf.UserID, nil
+}
+
+func (f *fakeTwoFactorRepo) Delete(ctx context.Context, userID int64) error {
+	f.tf = nil
+	return nil
+}
+
+func newTestTwoFactor(t *testing.T) (*TwoFactorService, *fakeTwoFactorRepo) {
+	t.Helper()
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &fakeTwoFactorRepo{tf: &domain.TwoFactor{UserID: 1, Secret: secret}}
+	users := &fakeUserRepo{user: &domain.User{ID: 1, Email: "alice@example.com"}}
+	guard := NewLoginGuard(newFakeThrottleRepo(), users, LoginGuardConfig{
+		MaxFailures:   3,
+		Lockout:       time.Minute,
+		FailureWindow: time.Hour,
+	})
+	return NewTwoFactorService(repo, users, nil, guard, "go-chat", time.Minute), repo
+}
+
+func TestTwoFactorRejectsReplayedSteps(t *testing.T) {
+	ctx := context.Background()
+	s, repo := newTestTwoFactor(t)
+	secret := repo.tf.Secret
+	current := totp.Step(time.Now())
+
+	if _, err := s.Confirm(ctx, 1, totp.Code(secret, current)); err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+
+	check := func(code string) bool {
+		t.Helper()
+		tf, err := repo.Get(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ok, err := s.checkCode(ctx, tf, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	if check(totp.Code(secret, current)) {
+		t.Error("code used for confirmation accepted again")
+	}
+	// Следующий шаг попадает в допустимое расхождение часов.
+	if !check(totp.Code(secret, current+1)) {
+		t.Error("fresh code from the next step rejected")
+	}
+	if check(totp.Code(secret, current+1)) {
+		t.Error("same code accepted twice")
+	}
+	if check(totp.Code(secret, current-1)) {
+		t.Error("code older than the last accepted one accepted")
+	}
+}
+
+func TestTwoFactorRecoveryCodes(t *testing.T) {
+	ctx := context.Background()
+	s, repo := newTestTwoFactor(t)
+
+	codes, err := s.Confirm(ctx, 1, totp.Code(repo.tf.Secret, totp.Step(time.Now())))
+	if err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+
+	tf, _ := repo.Get(ctx, 1)
+	// Пользователь может ввести код заглавными буквами, без дефисов и с пробелами.
+	typed := " " + strings.ToUpper(strings.ReplaceAll(codes[0], "-", " ")) + " "
+	if ok, err := s.checkCode(ctx, tf, typed); err != nil || !ok {
+		t.Fatalf("checkCode(%q) = %v, %v; want accepted", typed, ok, err)
+	}
+	if ok, _ := s.checkCode(ctx, tf, codes[0]); ok {
+		t.Error("recovery code accepted twice")
+	}
+	if ok, _ := s.checkCode(ctx, tf, codes[1]); !ok {
+		t.Error("unused recovery code rejected")
+	}
+
+	if err := s.Disable(ctx, 1, "0000-0000-0000-0000", Device{}); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("Disable with a wrong code: err = %v, want ErrInvalidCode", err)
+	}
+	if err := s.Disable(ctx, 1, codes[2], Device{}); err != nil {
+		t.Errorf("Disable with a recovery code: %v", err)
+	}
+}
+
+func TestTwoFactorDisableIsThrottled(t *testing.T) {
+	ctx := context.Background()
+	s, repo := newTestTwoFactor(t)
+	codes, err := s.Confirm(ctx, 1, totp.Code(repo.tf.Secret, totp.Step(time.Now())))
+	if err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	device := Device{IP: "203.0.113.7"}
+
+	for i := range 3 {
+		if err := s.Disable(ctx, 1, "0000-0000-0000-0000", device); !errors.Is(err, ErrInvalidCode) {
+			t.Fatalf("attempt %d: Disable err = %v, want ErrInvalidCode", i, err)
+		}
+	}
+
+	// После MaxFailures неверных кодов не принимается даже верный: подбор упирается в блокировку.
+	var throttled *ThrottledError
+	if err := s.Disable(ctx, 1, codes[0], device); !errors.As(err, &throttled) {
+		t.Fatalf("Disable after lockout: err = %v, want *ThrottledError", err)
+	}
+	if repo.tf == nil {
+		t.Fatal("two-factor authentication was disabled while locked")
+	}
+	if ok, _ := s.checkCode(ctx, repo.tf, codes[0]); !ok {
+		t.Error("recovery code was spent while locked")
+	}
+}
+
+func TestNormalizeCode(t *testing.T) {
+	tests := map[string]string{
+		"123 456":             "123456",
+		" 123-456 ":           "123456",
+		"ABCD-EFGH-IJKL-MNOP": "abcdefghijklmnop",
+		"abcd efgh ijkl mnop": "abcdefghijklmnop",
+	}
+	for in, want := range tests {
+		if got := normalizeCode(in); got != want {
+			t.Errorf("normalizeCode(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"log"
+	"time"
 
 	"github.com/caarlos0/env/v10"
 	"github.com/joho/godotenv"
@@ -9,8 +10,106 @@ import (
 
 type Config struct {
 	DBSource      string `env:"DB_SOURCE,required"`
-	JWTSecret     string `env:"JWT_SECRET,required"`
 	ServerAddress string `env:"SERVER_ADDRESS" envDefault:":8080"`
+	// JWTKeyDir - каталог с ключами подписи access-токенов в PEM. Закрытые ключи
+	// подписывают и проверяют токены, открытые - только проверяют.
+	JWTKeyDir string `env:"JWT_KEY_DIR" envDefault:"./keys"`
+	// JWTAlgorithm - алгоритм ключей, которые сервис создает сам: RS256 или EdDSA.
+	JWTAlgorithm string `env:"JWT_ALGORITHM" envDefault:"EdDSA"`
+	// JWTKeyRotation - как часто создавать новый ключ подписи. 0 отключает смену ключей.
+	JWTKeyRotation time.Duration `env:"JWT_KEY_ROTATION" envDefault:"168h"`
+	// JWTSecret - прежний общий секрет HS256. Нужен только на время перехода, чтобы
+	// не разлогинить пользователей: токены, подписанные им, принимаются, но новые не выпускаются.
+	JWTSecret string `env:"JWT_SECRET"`
+	// JWTSecretRetiredAt - момент перехода на асимметричные ключи (RFC 3339), обязателен
+	// вместе с JWTSecret. Принимаются только токены, выпущенные раньше, и только в течение
+	// AccessTokenTTL после него. После этого JWT_SECRET нужно удалить из настроек.
+	JWTSecretRetiredAt time.Time `env:"JWT_SECRET_RETIRED_AT"`
+	// AccessTokenTTL - время жизни JWT. Держится коротким: отзыв сессии проверяется
+	// на каждом запросе, но украденный токен все равно лучше ограничить по времени.
+	AccessTokenTTL time.Duration `env:"ACCESS_TOKEN_TTL" envDefault:"15m"`
+	// RefreshTokenTTL - время жизни refresh-токена. Каждое обновление выдает новый.
+	RefreshTokenTTL time.Duration `env:"REFRESH_TOKEN_TTL" envDefault:"720h"`
+	// AppURL - адрес веб-клиента. На его страницы /verify-email и /reset-password
+	// ведут ссылки из писем.
+	AppURL string `env:"APP_URL" envDefault:"http://localhost:8080"`
+	// RequireVerifiedEmail запрещает писать сообщения, пока пользователь не подтвердил почту.
+	RequireVerifiedEmail bool          `env:"REQUIRE_VERIFIED_EMAIL" envDefault:"false"`
+	EmailVerificationTTL time.Duration `env:"EMAIL_VERIFICATION_TTL" envDefault:"48h"`
+	PasswordResetTTL     time.Duration `env:"PASSWORD_RESET_TTL" envDefault:"1h"`
+
+	// Защита входа от подбора пароля. После LoginMaxFailures неудач подряд адрес
+	// блокируется на LoginLockout, до этого каждая неудача удваивает задержку начиная
+	// с LoginBackoff. Счетчик адреса сбрасывается после успешного входа или спустя
+	// LoginFailureWindow после последней неудачи.
+	LoginMaxFailures   int           `env:"LOGIN_MAX_FAILURES" envDefault:"5"`
+	LoginBackoff       time.Duration `env:"LOGIN_BACKOFF" envDefault:"1s"`
+	LoginLockout       time.Duration `env:"LOGIN_LOCKOUT" envDefault:"15m"`
+	LoginFailureWindow time.Duration `env:"LOGIN_FAILURE_WINDOW" envDefault:"24h"`
+	// LoginIPMaxFailures - сколько неудачных входов допускается с одного IP,
+	// прежде чем он будет заблокирован на LoginLockout.
+	LoginIPMaxFailures int           `env:"LOGIN_IP_MAX_FAILURES" envDefault:"50"`
+	LoginIPWindow      time.Duration `env:"LOGIN_IP_WINDOW" envDefault:"15m"`
+	// TrustProxyHeaders - брать IP клиента из X-Forwarded-For. Включать только за
+	// обратным прокси, который сам выставляет этот заголовок, иначе IP можно подделать.
+	TrustProxyHeaders bool `env:"TRUST_PROXY_HEADERS" envDefault:"false"`
+
+	// MFAIssuer - имя сервиса, под которым аккаунт появится в приложении-аутентификаторе.
+	MFAIssuer string `env:"MFA_ISSUER" envDefault:"go-chat"`
+	// MFAChallengeTTL - сколько после ввода пароля ждать код второго фактора.
+	MFAChallengeTTL time.Duration `env:"MFA_CHALLENGE_TTL" envDefault:"5m"`
+
+	// Вход через провайдера OpenID Connect. Выключен, если OIDCIssuer пуст.
+	// OIDCRedirectURL должен указывать на /api/v1/oidc/callback этого сервиса.
+	OIDCIssuer       string   `env:"OIDC_ISSUER"`
+	OIDCClientID     string   `env:"OIDC_CLIENT_ID"`
+	OIDCClientSecret string   `env:"OIDC_CLIENT_SECRET"`
+	OIDCRedirectURL  string   `env:"OIDC_REDIRECT_URL"`
+	OIDCScopes       []string `env:"OIDC_SCOPES" envSeparator:"," envDefault:"openid,email,profile"`
+	// OIDCAutoProvision - создавать аккаунт при первом входе пользователя с новым адресом.
+	OIDCAutoProvision bool `env:"OIDC_AUTO_PROVISION" envDefault:"true"`
+
+	// Mailer - способ отправки писем: "log" (в лог сервера), "file" (.eml-файлы в MailDir)
+	// или "smtp".
+	Mailer       string `env:"MAILER" envDefault:"log"`
+	MailFrom     string `env:"MAIL_FROM" envDefault:"go-chat <no-reply@localhost>"`
+	MailDir      string `env:"MAIL_DIR" envDefault:"./mail"`
+	SMTPHost     string `env:"SMTP_HOST"`
+	SMTPPort     int    `env:"SMTP_PORT" envDefault:"587"`
+	SMTPUsername string `env:"SMTP_USERNAME"`
+	SMTPPassword string `env:"SMTP_PASSWORD"`
+
+	// Broadcaster - способ рассылки событий WebSocket: "memory" для одного экземпляра
+	// или "postgres" для нескольких экземпляров за балансировщиком.
+	Broadcaster string `env:"BROADCASTER" envDefault:"memory"`
+
+	// StorageBackend - хранилище вложений: "local" (каталог StorageLocalDir) или "s3".
+	StorageBackend    string `env:"STORAGE_BACKEND" envDefault:"local"`
+	StorageLocalDir   string `env:"STORAGE_LOCAL_DIR" envDefault:"./uploads"`
+	S3Endpoint        string `env:"S3_ENDPOINT"`
+	S3Region          string `env:"S3_REGION" envDefault:"us-east-1"`
+	S3Bucket          string `env:"S3_BUCKET"`
+	S3AccessKeyID     string `env:"S3_ACCESS_KEY_ID"`
+	S3SecretAccessKey string `env:"S3_SECRET_ACCESS_KEY"`
+	// MaxAttachmentSize - максимальный размер вложения в байтах.
+	MaxAttachmentSize int64 `env:"MAX_ATTACHMENT_SIZE" envDefault:"10485760"`
+	// AllowedAttachmentTypes - MIME-типы, которые разрешено загружать.
+	// Тип определяется сервером по содержимому файла, а не по заголовкам клиента.
+	AllowedAttachmentTypes []string `env:"ALLOWED_ATTACHMENT_TYPES" envSeparator:"," envDefault:"image/png,image/jpeg,image/gif,image/webp,application/pdf,text/plain"`
+	// UnlinkedAttachmentTTL - через сколько удаляется загруженный, но не прикрепленный файл.
+	UnlinkedAttachmentTTL time.Duration `env:"UNLINKED_ATTACHMENT_TTL" envDefault:"24h"`
+	// StorageSweepInterval - как часто из хранилища удаляются файлы без вложений.
+	StorageSweepInterval time.Duration `env:"STORAGE_SWEEP_INTERVAL" envDefault:"1h"`
+
+	// LinkPreviews включает построение карточек для ссылок в сообщениях.
+	LinkPreviews        bool          `env:"LINK_PREVIEWS" envDefault:"true"`
+	LinkPreviewWorkers  int           `env:"LINK_PREVIEW_WORKERS" envDefault:"4"`
+	LinkPreviewTimeout  time.Duration `env:"LINK_PREVIEW_TIMEOUT" envDefault:"5s"`
+	LinkPreviewMaxBytes int64         `env:"LINK_PREVIEW_MAX_BYTES" envDefault:"1048576"`
+	LinkPreviewCacheTTL time.Duration `env:"LINK_PREVIEW_CACHE_TTL" envDefault:"24h"`
+	// LinkPreviewAllowedNetworks - адреса и подсети (CIDR) из приватных диапазонов,
+	// страницы с которых все же разрешено загружать. По умолчанию они запрещены.
+	LinkPreviewAllowedNetworks []string `env:"LINK_PREVIEW_ALLOWED_NETWORKS" envSeparator:","`
 }
 
 func Load() (*Config, error) {
@@ -2,10 +2,80 @@ package domain
 
 import "time"
 
+// Видимость комнаты.
+const (
+	// RoomPublic - комнату видят и читают все пользователи.
+	RoomPublic = "public"
+	// RoomPrivate - комнату видят, читают и пишут в нее только участники.
+	RoomPrivate = "private"
+)
+
+// Тип комнаты.
+const (
+	// RoomKindRoom - обычная именованная комната.
+	RoomKindRoom = "room"
+	// RoomKindDirect - личная переписка двух пользователей.
+	RoomKindDirect = "direct"
+)
+
 type Room struct {
-	ID        int64     `json:"id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	Kind       string `json:"kind"`
+	Visibility string `json:"visibility"`
+	// OwnerID пуст у комнат, созданных до появления владельцев, и после удаления владельца.
+	OwnerID *int64 `json:"owner_id"`
+	// ReadReceipts - видят ли участники, кто до какого сообщения дочитал.
+	ReadReceipts bool      `json:"read_receipts"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// RoomSummary - комната в списке комнат пользователя вместе с его позицией прочтения.
+type RoomSummary struct {
+	Room
+	// LastReadMessageID - последнее прочитанное пользователем сообщение, 0 - не читал.
+	LastReadMessageID int64 `json:"last_read_message_id"`
+	// UnreadCount - число непрочитанных сообщений других участников с момента вступления.
+	UnreadCount int `json:"unread_count"`
+	// LastMessage пуст, пока в комнате нет сообщений.
+	LastMessage *Message `json:"last_message"`
+}
+
+// ReadMarker - позиция прочтения комнаты пользователем.
+// Полезная нагрузка события read.updated, которое получают только устройства этого пользователя.
+type ReadMarker struct {
+	RoomID            int64 `json:"room_id"`
+	UserID            int64 `json:"user_id"`
+	LastReadMessageID int64 `json:"last_read_message_id"`
+	UnreadCount       int   `json:"unread_count"`
+}
+
+// ReadReceipt - позиция прочтения участника, видимая остальным участникам комнаты.
+// Полезная нагрузка события receipt.updated.
+type ReadReceipt struct {
+	RoomID            int64     `json:"room_id"`
+	UserID            int64     `json:"user_id"`
+	Username          string    `json:"username"`
+	LastReadMessageID int64     `json:"last_read_message_id"`
+	ReadAt            time.Time `json:"read_at"`
+}
+
+// IsDirect сообщает, является ли комната личной перепиской.
+func (r *Room) IsDirect() bool {
+	return r.Kind == RoomKindDirect
+}
+
+// IsPrivate сообщает, доступна ли комната только участникам.
+func (r *Room) IsPrivate() bool {
+	return r.Visibility == RoomPrivate
+}
+
+type RoomMember struct {
+	RoomID   int64     `json:"room_id"`
+	UserID   int64     `json:"user_id"`
+	Username string    `json:"username"`
+	Role     Role      `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
 }
 
 type Message struct {
@@ -15,4 +85,104 @@ type Message struct {
 	Username  string    `json:"username,omitempty"`
 	Content   string    `json:"content"`
 	CreatedAt time.Time `json:"created_at"`
-}
\ No newline at end of file
+	// EditedAt - время последнего редактирования.
+	EditedAt *time.Time `json:"edited_at,omitempty"`
+	// DeletedAt - время удаления. У удаленного сообщения остается только
+	// "надгробие": ID, автор и время, а текст стирается.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// ParentID - сообщение, в ветке которого опубликован ответ.
+	ParentID *int64 `json:"parent_id,omitempty"`
+	// ReplyCount и LastReplyAt описывают ветку ответов на сообщение.
+	ReplyCount  int        `json:"reply_count,omitempty"`
+	LastReplyAt *time.Time `json:"last_reply_at,omitempty"`
+	// Reactions - число реакций на сообщение по каждому эмодзи.
+	Reactions []ReactionCount `json:"reactions,omitempty"`
+	// Attachments - прикрепленные к сообщению файлы.
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// LinkPreviews - карточки ссылок из текста. Заполняются в фоне после сохранения,
+	// о готовности сообщает событие message.updated.
+	LinkPreviews []LinkPreview `json:"link_previews,omitempty"`
+}
+
+// AttachmentPath - путь API, по которому скачиваются вложения: AttachmentPath + ID.
+const AttachmentPath = "/api/v1/attachments/"
+
+// Attachment - метаданные загруженного файла. Содержимое хранится в storage.Storage.
+type Attachment struct {
+	ID     int64 `json:"id"`
+	RoomID int64 `json:"room_id"`
+	UserID int64 `json:"user_id"`
+	// MessageID пуст, пока файл не прикреплен к сообщению.
+	MessageID   *int64    `json:"message_id,omitempty"`
+	StorageKey  string    `json:"-"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	URL         string    `json:"url"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// LinkPreview - метаданные страницы по ссылке (OpenGraph, <title>, description).
+type LinkPreview struct {
+	URL         string    `json:"url"`
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	ImageURL    string    `json:"image_url,omitempty"`
+	SiteName    string    `json:"site_name,omitempty"`
+	FetchedAt   time.Time `json:"-"`
+}
+
+// IsEmpty сообщает, что на странице не нашлось ничего, что можно показать.
+func (p *LinkPreview) IsEmpty() bool {
+	return p.Title == "" && p.Description == "" && p.ImageURL == ""
+}
+
+type ReactionCount struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+}
+
+// ReactionUpdate - полезная нагрузка событий reaction.added и reaction.removed.
+type ReactionUpdate struct {
+	MessageID int64  `json:"message_id"`
+	RoomID    int64  `json:"room_id"`
+	UserID    int64  `json:"user_id"`
+	Emoji     string `json:"emoji"`
+	// Count - число реакций этим эмодзи после изменения.
+	Count int `json:"count"`
+}
+
+// SearchResult - сообщение, найденное полнотекстовым поиском.
+type SearchResult struct {
+	Message
+	RoomName string `json:"room_name"`
+	// Snippet - фрагмент текста с найденными словами, обернутыми в <mark>.
+	// Остальной текст экранирован для вставки в HTML.
+	Snippet string  `json:"snippet"`
+	Rank    float32 `json:"rank"`
+}
+
+// ThreadSummary - состояние ветки ответов, рассылаемое при появлении и удалении ответа.
+type ThreadSummary struct {
+	MessageID   int64      `json:"message_id"`
+	RoomID      int64      `json:"room_id"`
+	ReplyCount  int        `json:"reply_count"`
+	LastReplyAt *time.Time `json:"last_reply_at"`
+}
+
+// IsDeleted сообщает, удалено ли сообщение.
+func (m *Message) IsDeleted() bool {
+	return m.DeletedAt != nil
+}
+
+// DirectConversation - личная переписка с точки зрения одного из ее участников.
+type DirectConversation struct {
+	RoomID    int64     `json:"room_id"`
+	OtherUser UserRef   `json:"other_user"`
+	CreatedAt time.Time `json:"created_at"`
+	// LastMessage пуст, пока в переписке нет сообщений.
+	LastMessage *Message `json:"last_message"`
+	// LastReadMessageID и UnreadCount - см. RoomSummary.
+	LastReadMessageID int64 `json:"last_read_message_id"`
+	UnreadCount       int   `json:"unread_count"`
+}
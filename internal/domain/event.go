@@ -0,0 +1,96 @@
+package domain
+
+import "encoding/json"
+
+// ProtocolVersion - текущая версия протокола событий WebSocket.
+const ProtocolVersion = 1
+
+// EventType - тип события, передаваемого через WebSocket.
+type EventType string
+
+const (
+	EventMessageCreated  EventType = "message.created"
+	EventMessageEdited   EventType = "message.edited"
+	EventMessageDeleted  EventType = "message.deleted"
+	EventMessageUpdated  EventType = "message.updated"
+	EventThreadUpdated   EventType = "thread.updated"
+	EventReactionAdded   EventType = "reaction.added"
+	EventReactionRemoved EventType = "reaction.removed"
+	EventRoomUpdated     EventType = "room.updated"
+	EventRoomDeleted     EventType = "room.deleted"
+	EventMemberRemoved   EventType = "member.removed"
+	EventReadUpdated     EventType = "read.updated"
+	EventReceiptUpdated  EventType = "receipt.updated"
+	EventSessionRevoked  EventType = "session.revoked"
+	EventPresence        EventType = "presence"
+	EventTyping          EventType = "typing"
+	EventError           EventType = "error"
+	EventAck             EventType = "ack"
+)
+
+// Event - конверт, в который заворачивается весь трафик WebSocket.
+type Event struct {
+	Type    EventType   `json:"type"`
+	Payload interface{} `json:"payload,omitempty"`
+	// Seq - порядковый номер события в рамках соединения. Назначается при отправке.
+	Seq int64 `json:"seq"`
+}
+
+// MemberRemovedPayload - полезная нагрузка события member.removed.
+type MemberRemovedPayload struct {
+	RoomID int64 `json:"room_id"`
+	UserID int64 `json:"user_id"`
+}
+
+func NewEvent(eventType EventType, payload interface{}) *Event {
+	return &Event{Type: eventType, Payload: payload}
+}
+
+// eventPayloads создает пустую полезную нагрузку для известных типов событий.
+// Используется при разборе событий, пришедших от других экземпляров сервиса.
+var eventPayloads = map[EventType]func() interface{}{
+	EventMessageCreated:  func() interface{} { return new(Message) },
+	EventMessageEdited:   func() interface{} { return new(Message) },
+	EventMessageDeleted:  func() interface{} { return new(Message) },
+	EventMessageUpdated:  func() interface{} { return new(Message) },
+	EventThreadUpdated:   func() interface{} { return new(ThreadSummary) },
+	EventReactionAdded:   func() interface{} { return new(ReactionUpdate) },
+	EventReactionRemoved: func() interface{} { return new(ReactionUpdate) },
+	EventRoomUpdated:     func() interface{} { return new(Room) },
+	EventRoomDeleted:     func() interface{} { return new(Room) },
+	EventMemberRemoved:   func() interface{} { return new(MemberRemovedPayload) },
+	EventReadUpdated:     func() interface{} { return new(ReadMarker) },
+	EventReceiptUpdated:  func() interface{} { return new(ReadReceipt) },
+	EventPresence:        func() interface{} { return new(Presence) },
+	EventTyping:          func() interface{} { return new(Typing) },
+	EventSessionRevoked:  func() interface{} { return new(SessionRevoked) },
+}
+
+// DecodeEvent восстанавливает событие из JSON. Полезная нагрузка известных событий
+// разбирается в соответствующие типы, остальные передаются дальше как есть.
+func DecodeEvent(data []byte) (*Event, error) {
+	var raw struct {
+		Type    EventType       `json:"type"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	event := &Event{Type: raw.Type}
+	if len(raw.Payload) == 0 {
+		return event, nil
+	}
+
+	newPayload, ok := eventPayloads[raw.Type]
+	if !ok {
+		event.Payload = raw.Payload
+		return event, nil
+	}
+	payload := newPayload()
+	if err := json.Unmarshal(raw.Payload, payload); err != nil {
+		return nil, err
+	}
+	event.Payload = payload
+	return event, nil
+}
@@ -5,5 +5,7 @@ import "github.com/golang-jwt/jwt/v5"
 type JWTCustomClaims struct {
 	UserID int64 `json:"user_id"`
 	Username string `json:"username"`
+	// SessionID - сессия, в которой выпущен токен. После ее отзыва токен не принимается.
+	SessionID int64 `json:"sid"`
 	jwt.RegisteredClaims
 }
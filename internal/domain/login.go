@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+// Причины неудачного входа для журнала.
+const (
+	LoginFailureUnknownEmail  = "unknown_email"
+	LoginFailureWrongPassword = "wrong_password"
+	LoginFailureWrongCode     = "wrong_two_factor_code"
+	LoginFailureThrottled     = "throttled"
+)
+
+// FailedLogin - запись журнала о неудачной попытке входа.
+type FailedLogin struct {
+	ID    int64
+	Email string
+	// UserID пуст, если адрес не зарегистрирован.
+	UserID    *int64
+	IP        string
+	UserAgent string
+	Reason    string
+	CreatedAt time.Time
+}
@@ -0,0 +1,31 @@
+package domain
+
+import "time"
+
+const (
+	PresenceOnline  = "online"
+	PresenceOffline = "offline"
+)
+
+// Presence - сетевой статус пользователя. Полезная нагрузка события presence,
+// которое рассылается в комнату, когда пользователь открывает в ней первое
+// соединение или закрывает последнее.
+type Presence struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username,omitempty"`
+	// RoomID задан в событиях комнаты.
+	RoomID int64  `json:"room_id,omitempty"`
+	Status string `json:"status"`
+	// LastSeenAt - когда пользователь был в сети последний раз. Пуст, пока он в сети
+	// или если ни разу не подключался.
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// Typing - полезная нагрузка события typing: пользователь начал или закончил набирать
+// сообщение. Такие события не сохраняются и не досылаются при переподключении.
+type Typing struct {
+	RoomID   int64  `json:"room_id"`
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Typing   bool   `json:"typing"`
+}
@@ -0,0 +1,70 @@
+package domain
+
+// Role - роль участника в комнате.
+type Role string
+
+const (
+	RoleOwner     Role = "owner"
+	RoleAdmin     Role = "admin"
+	RoleModerator Role = "moderator"
+	RoleMember    Role = "member"
+)
+
+// Permission - действие в комнате, требующее определенной роли.
+type Permission int
+
+const (
+	// PermPostMessage - отправка сообщений.
+	PermPostMessage Permission = iota
+	// PermRemoveMessage - удаление чужих сообщений.
+	PermRemoveMessage
+	// PermKickMember - исключение участников с более низкой ролью.
+	PermKickMember
+	// PermManageMembers - добавление участников и изменение их ролей.
+	PermManageMembers
+	// PermUpdateRoom - изменение названия и настроек комнаты.
+	PermUpdateRoom
+	// PermDeleteRoom - удаление комнаты.
+	PermDeleteRoom
+)
+
+// minRole - минимальная роль, которой разрешено действие.
+var minRole = map[Permission]Role{
+	PermPostMessage:   RoleMember,
+	PermRemoveMessage: RoleModerator,
+	PermKickMember:    RoleModerator,
+	PermManageMembers: RoleAdmin,
+	PermUpdateRoom:    RoleAdmin,
+	PermDeleteRoom:    RoleAdmin,
+}
+
+func (r Role) rank() int {
+	switch r {
+	case RoleOwner:
+		return 4
+	case RoleAdmin:
+		return 3
+	case RoleModerator:
+		return 2
+	case RoleMember:
+		return 1
+	}
+	return 0
+}
+
+// IsValid сообщает, является ли роль одной из известных.
+func (r Role) IsValid() bool {
+	return r.rank() > 0
+}
+
+// Can сообщает, разрешено ли действие участнику с этой ролью.
+func (r Role) Can(p Permission) bool {
+	required, ok := minRole[p]
+	return ok && r.rank() >= required.rank()
+}
+
+// Outranks сообщает, стоит ли роль строго выше другой. Участник может исключать
+// и менять роли только тем, кто ниже него.
+func (r Role) Outranks(other Role) bool {
+	return r.rank() > other.rank()
+}
@@ -0,0 +1,29 @@
+package domain
+
+import "time"
+
+// Session - вход пользователя с одного устройства, к которому привязаны
+// его access- и refresh-токены.
+type Session struct {
+	ID     int64 `json:"id"`
+	UserID int64 `json:"user_id"`
+	// UserAgent и IP - с какого устройства выполнен вход или последнее обновление токенов.
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// Current отмечает сессию, из которой сделан запрос.
+	Current bool `json:"current"`
+}
+
+// IsRevoked сообщает, отозвана ли сессия.
+func (s *Session) IsRevoked() bool {
+	return s.RevokedAt != nil
+}
+
+// SessionRevoked - полезная нагрузка события session.revoked, которое получают
+// соединения пользователя. Соединения отозванных сессий после него закрываются.
+type SessionRevoked struct {
+	SessionIDs []int64 `json:"session_ids"`
+}
@@ -0,0 +1,19 @@
+package domain
+
+import "time"
+
+// TwoFactor - TOTP, подключенный пользователем как второй фактор входа.
+type TwoFactor struct {
+	UserID int64
+	Secret []byte
+	// LastUsedStep - шаг времени последнего принятого кода.
+	LastUsedStep int64
+	CreatedAt    time.Time
+	// ConfirmedAt пуст, пока пользователь не подтвердил подключение кодом из приложения.
+	ConfirmedAt *time.Time
+}
+
+// IsConfirmed сообщает, запрашивается ли код при входе.
+func (t *TwoFactor) IsConfirmed() bool {
+	return t.ConfirmedAt != nil
+}
@@ -8,4 +8,24 @@ type User struct {
 	Email string `json:"email"`
 	PasswordHash string `json:"-"`
 	CreatedAt time.Time `json:"created_at"`
-}
\ No newline at end of file
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+}
+
+// IsEmailVerified сообщает, подтвердил ли пользователь свой адрес.
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// TokenPurpose - назначение одноразового токена, отправляемого пользователю по почте.
+type TokenPurpose string
+
+const (
+	TokenPurposeEmailVerification TokenPurpose = "email_verification"
+	TokenPurposePasswordReset     TokenPurpose = "password_reset"
+)
+
+// UserRef - публичные сведения о пользователе.
+type UserRef struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
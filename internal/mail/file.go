@@ -0,0 +1,59 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer создает Mailer, который сохраняет каждое письмо в отдельный .eml-файл
+// в каталоге dir. Подходит для разработки и тестов.
+func NewFileMailer(dir, from string) (Mailer, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &fileMailer{dir: dir, from: from}, nil
+}
+
+func (m *fileMailer) Send(ctx context.Context, msg *Message) error {
+	data, err := render(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o640)
+}
+
+type logMailer struct {
+	from string
+}
+
+// NewLogMailer создает Mailer, который только пишет письма в лог.
+// Письма содержат одноразовые ссылки, поэтому в продакшене он неуместен.
+func NewLogMailer(from string) Mailer {
+	return &logMailer{from: from}
+}
+
+func (m *logMailer) Send(ctx context.Context, msg *Message) error {
+	data, err := render(m.from, msg)
+	if err != nil {
+		return err
+	}
+	log.Printf("mail to %s:\n%s", msg.To, data)
+	return nil
+}
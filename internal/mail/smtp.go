@@ -0,0 +1,61 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+)
+
+// SMTPConfig - параметры SMTP-сервера.
+type SMTPConfig struct {
+	Host string
+	Port int
+	// Username и Password не нужны, если сервер не требует аутентификации.
+	Username string
+	Password string
+	From     string
+}
+
+type smtpMailer struct {
+	cfg  SMTPConfig
+	addr string
+	from string
+}
+
+// NewSMTPMailer создает Mailer, отправляющий письма через SMTP-сервер.
+// Если сервер поддерживает STARTTLS, соединение шифруется.
+func NewSMTPMailer(cfg SMTPConfig) (Mailer, error) {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, err
+	}
+	return &smtpMailer{
+		cfg:  cfg,
+		addr: net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		from: from.Address,
+	}, nil
+}
+
+func (m *smtpMailer) Send(ctx context.Context, msg *Message) error {
+	data, err := render(m.cfg.From, msg)
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+
+	// net/smtp не принимает контекст, поэтому отправка лишь не начинается после его отмены.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return smtp.SendMail(m.addr, auth, m.from, []string{to.Address}, data)
+}
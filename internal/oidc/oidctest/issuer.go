@@ -0,0 +1,179 @@
+// Package oidctest поднимает поддельного провайдера OpenID Connect для тестов:
+// discovery, JWKS и token endpoint с проверкой PKCE.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Issuer - провайдер, выдающий ID-токены, подписанные ключом RS256.
+type Issuer struct {
+	*httptest.Server
+	ClientID string
+
+	mu           sync.Mutex
+	key          *rsa.PrivateKey
+	kid          string
+	keys         int
+	grants       map[string]grant
+	codes        int
+	jwksRequests int
+}
+
+// grant - код авторизации, выданный провайдером.
+type grant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+// NewIssuer запускает провайдера для клиента clientID. Сервер закрывается вместе с тестом.
+func NewIssuer(t testing.TB, clientID string) *Issuer {
+	t.Helper()
+	i := &Issuer{ClientID: clientID, grants: make(map[string]grant)}
+	i.RotateKey(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", i.serveDiscovery)
+	mux.HandleFunc("GET /jwks", i.serveJWKS)
+	mux.HandleFunc("POST /token", i.serveToken)
+	i.Server = httptest.NewServer(mux)
+	t.Cleanup(i.Close)
+	return i
+}
+
+// RotateKey заменяет ключ подписи новым ключом с другим kid. Старый ключ из JWKS пропадает.
+func (i *Issuer) RotateKey(t testing.TB) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.keys++
+	i.key = key
+	i.kid = fmt.Sprintf("key-%d", i.keys)
+}
+
+// JWKSRequests возвращает, сколько раз клиент запрашивал JWKS.
+func (i *Issuer) JWKSRequests() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.jwksRequests
+}
+
+// Claims возвращает утверждения действительного ID-токена для пользователя subject.
+func (i *Issuer) Claims(subject, nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":   i.URL,
+		"aud":   i.ClientID,
+		"sub":   subject,
+		"nonce": nonce,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+	}
+}
+
+// Authorize выдает код авторизации, как после входа пользователя на странице провайдера.
+// По коду token endpoint вернет ID-токен с claims, если code_verifier соответствует challenge.
+func (i *Issuer) Authorize(challenge string, claims jwt.MapClaims) string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.codes++
+	code := fmt.Sprintf("code-%d", i.codes)
+	i.grants[code] = grant{challenge: challenge, claims: claims}
+	return code
+}
+
+func (i *Issuer) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 i.URL,
+		"authorization_endpoint": i.URL + "/authorize",
+		"token_endpoint":         i.URL + "/token",
+		"jwks_uri":               i.URL + "/jwks",
+	})
+}
+
+func (i *Issuer) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.jwksRequests++
+
+	pub := i.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": i.kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (i *Issuer) serveToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, "invalid_request")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("client_id") != i.ClientID {
+		writeError(w, "invalid_request")
+		return
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	code := r.PostForm.Get("code")
+	g, ok := i.grants[code]
+	if !ok {
+		writeError(w, "invalid_grant")
+		return
+	}
+	// Код одноразовый, даже если code_verifier не подошел.
+	delete(i.grants, code)
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		writeError(w, "invalid_grant")
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, g.claims)
+	token.Header["kid"] = i.kid
+	idToken, err := token.SignedString(i.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "access-" + code,
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func writeError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,28 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// RandomString возвращает случайную строку из n случайных байт в base64url.
+// Подходит для state, nonce и code_verifier.
+func RandomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NewCodeVerifier создает code_verifier для PKCE (RFC 7636): 43 символа из 32 случайных байт.
+func NewCodeVerifier() (string, error) {
+	return RandomString(32)
+}
+
+// CodeChallenge вычисляет code_challenge методом S256.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
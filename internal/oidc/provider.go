@@ -0,0 +1,236 @@
+// Package oidc реализует вход через OpenID Connect: authorization code flow с PKCE
+// и проверку ID-токенов по ключам провайдера.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// Максимальный размер ответа провайдера.
+	maxResponseSize = 1 << 20
+	// Допустимое расхождение часов с провайдером.
+	clockSkew = time.Minute
+)
+
+// ErrInvalidIDToken означает, что ID-токен не прошел проверку.
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+// Config - параметры клиента OpenID Connect.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// HTTPClient используется для запросов к провайдеру. По умолчанию - клиент с таймаутом 10 секунд.
+	HTTPClient *http.Client
+}
+
+// Claims - утверждения ID-токена, нужные для входа.
+type Claims struct {
+	jwt.RegisteredClaims
+	Nonce             string   `json:"nonce"`
+	AuthorizedParty   string   `json:"azp"`
+	Email             string   `json:"email"`
+	EmailVerified     flexBool `json:"email_verified"`
+	PreferredUsername string   `json:"preferred_username"`
+	Name              string   `json:"name"`
+}
+
+// flexBool принимает и true, и "true": некоторые провайдеры передают email_verified строкой.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case bool:
+		*b = flexBool(v)
+	case string:
+		*b = flexBool(strings.EqualFold(v, "true"))
+	default:
+		*b = false
+	}
+	return nil
+}
+
+// metadata - документ discovery (/.well-known/openid-configuration).
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider - провайдер OpenID Connect. Его настройки запрашиваются при первом
+// обращении, поэтому недоступный провайдер не мешает запуску сервиса.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu   sync.Mutex
+	meta *metadata
+	keys *keySet
+}
+
+func NewProvider(cfg Config) *Provider {
+	cfg.Issuer = strings.TrimRight(cfg.Issuer, "/")
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{cfg: cfg, client: client}
+}
+
+// AuthCodeURL возвращает адрес страницы входа провайдера.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	meta, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.cfg.ClientID)
+	params.Set("redirect_uri", p.cfg.RedirectURL)
+	params.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", CodeChallenge(codeVerifier))
+	params.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// Exchange обменивает код авторизации на токены и возвращает проверенные утверждения ID-токена.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	meta, keys, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.cfg.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&token); err != nil {
+		return nil, fmt.Errorf("token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request: %s: %s %s", resp.Status, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: token response has no id_token", ErrInvalidIDToken)
+	}
+
+	return p.verify(ctx, meta, keys, token.IDToken, nonce)
+}
+
+// verify проверяет подпись, издателя, получателя, срок действия и nonce ID-токена.
+func (p *Provider) verify(ctx context.Context, meta *metadata, keys *keySet, raw, nonce string) (*Claims, error) {
+	claims := new(Claims)
+	_, err := jwt.ParseWithClaims(raw, claims,
+		func(t *jwt.Token) (interface{}, error) {
+			kid, _ := t.Header["kid"].(string)
+			return keys.key(ctx, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	// Токен, выданный для нескольких клиентов, должен называть нас предъявителем.
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID {
+		return nil, fmt.Errorf("%w: unexpected azp", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// Issuer возвращает издателя, подтвержденного discovery.
+func (p *Provider) Issuer(ctx context.Context) (string, error) {
+	meta, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return meta.Issuer, nil
+}
+
+// discover загружает и кэширует настройки провайдера. Неудачная попытка не кэшируется.
+func (p *Provider) discover(ctx context.Context) (*metadata, *keySet, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.meta != nil {
+		return p.meta, p.keys, nil
+	}
+
+	meta := new(metadata)
+	if err := getJSON(ctx, p.client, p.cfg.Issuer+"/.well-known/openid-configuration", meta); err != nil {
+		return nil, nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	// Издатель в документе обязан совпадать с настроенным (OpenID Connect Discovery, раздел 4.3).
+	if strings.TrimRight(meta.Issuer, "/") != p.cfg.Issuer {
+		return nil, nil, fmt.Errorf("oidc discovery: issuer mismatch: %q", meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, nil, errors.New("oidc discovery: incomplete provider metadata")
+	}
+
+	p.meta = meta
+	p.keys = newKeySet(meta.JWKSURI, p.client)
+	return p.meta, p.keys, nil
+}
@@ -0,0 +1,181 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"go-chat/internal/oidc/oidctest"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testClientID = "go-chat"
+
+func newTestProvider(issuer *oidctest.Issuer) *Provider {
+	return NewProvider(Config{
+		Issuer:      issuer.URL,
+		ClientID:    testClientID,
+		RedirectURL: "https://chat.example.com/api/auth/sso/callback",
+		Scopes:      []string{"openid", "email"},
+		HTTPClient:  issuer.Client(),
+	})
+}
+
+// authorize проходит вход на стороне провайдера: берет code_challenge из адреса
+// страницы входа и выдает по нему код с утверждениями claims.
+func authorize(t *testing.T, p *Provider, issuer *oidctest.Issuer, verifier string, claims jwt.MapClaims) string {
+	t.Helper()
+	authURL, err := p.AuthCodeURL(context.Background(), "state", "nonce", verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := u.Query()
+	if got := params.Get("code_challenge_method"); got != "S256" {
+		t.Fatalf("code_challenge_method = %q, want S256", got)
+	}
+	return issuer.Authorize(params.Get("code_challenge"), claims)
+}
+
+func TestExchange(t *testing.T) {
+	issuer := oidctest.NewIssuer(t, testClientID)
+	p := newTestProvider(issuer)
+	verifier, err := NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := issuer.Claims("user-1", "nonce-1")
+	claims["email"] = "alice@example.com"
+	claims["email_verified"] = "true"
+	code := authorize(t, p, issuer, verifier, claims)
+
+	got, err := p.Exchange(context.Background(), code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if got.Subject != "user-1" || got.Email != "alice@example.com" || !bool(got.EmailVerified) {
+		t.Errorf("claims = %+v", got)
+	}
+	if got.Issuer != issuer.URL {
+		t.Errorf("issuer = %q, want %q", got.Issuer, issuer.URL)
+	}
+}
+
+func TestExchangeRejectsWrongCodeVerifier(t *testing.T) {
+	issuer := oidctest.NewIssuer(t, testClientID)
+	p := newTestProvider(issuer)
+	code := authorize(t, p, issuer, "verifier-from-begin", issuer.Claims("user-1", "nonce-1"))
+
+	_, err := p.Exchange(context.Background(), code, "another-verifier", "nonce-1")
+	if err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("Exchange err = %v, want invalid_grant", err)
+	}
+}
+
+func TestExchangeRejectsInvalidIDToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(claims jwt.MapClaims)
+	}{
+		{"nonce", func(c jwt.MapClaims) { c["nonce"] = "replayed" }},
+		{"audience", func(c jwt.MapClaims) { c["aud"] = "another-client" }},
+		{"azp", func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "another-client"}
+			c["azp"] = "another-client"
+		}},
+		{"missing azp", func(c jwt.MapClaims) { c["aud"] = []string{testClientID, "another-client"} }},
+		{"issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"expired", func(c jwt.MapClaims) {
+			c["iat"] = time.Now().Add(-time.Hour).Unix()
+			c["exp"] = time.Now().Add(-2 * clockSkew).Unix()
+		}},
+		{"no exp", func(c jwt.MapClaims) { delete(c, "exp") }},
+		{"no sub", func(c jwt.MapClaims) { delete(c, "sub") }},
+	}
+
+	issuer := oidctest.NewIssuer(t, testClientID)
+	p := newTestProvider(issuer)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := issuer.Claims("user-1", "nonce-1")
+			tt.modify(claims)
+			code := authorize(t, p, issuer, "verifier", claims)
+
+			if _, err := p.Exchange(context.Background(), code, "verifier", "nonce-1"); !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("Exchange err = %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestExchangeAcceptsAzpForMultipleAudiences(t *testing.T) {
+	issuer := oidctest.NewIssuer(t, testClientID)
+	p := newTestProvider(issuer)
+	claims := issuer.Claims("user-1", "nonce-1")
+	claims["aud"] = []string{testClientID, "another-client"}
+	claims["azp"] = testClientID
+	code := authorize(t, p, issuer, "verifier", claims)
+
+	if _, err := p.Exchange(context.Background(), code, "verifier", "nonce-1"); err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+}
+
+func TestExchangeRefetchesKeysForUnknownKid(t *testing.T) {
+	ctx := context.Background()
+	issuer := oidctest.NewIssuer(t, testClientID)
+	p := newTestProvider(issuer)
+
+	code := authorize(t, p, issuer, "verifier", issuer.Claims("user-1", "nonce-1"))
+	if _, err := p.Exchange(ctx, code, "verifier", "nonce-1"); err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if got := issuer.JWKSRequests(); got != 1 {
+		t.Fatalf("JWKS requests = %d, want 1", got)
+	}
+
+	// Сразу после загрузки ключей неизвестный kid не приводит к повторному запросу.
+	issuer.RotateKey(t)
+	code = authorize(t, p, issuer, "verifier", issuer.Claims("user-1", "nonce-1"))
+	if _, err := p.Exchange(ctx, code, "verifier", "nonce-1"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("Exchange err = %v, want ErrInvalidIDToken", err)
+	}
+	if got := issuer.JWKSRequests(); got != 1 {
+		t.Fatalf("JWKS requests = %d, want 1", got)
+	}
+
+	// Когда интервал прошел, ключи перечитываются и новый kid находится.
+	p.keys.mu.Lock()
+	p.keys.fetchedAt = time.Now().Add(-jwksRefreshInterval)
+	p.keys.mu.Unlock()
+
+	code = authorize(t, p, issuer, "verifier", issuer.Claims("user-1", "nonce-1"))
+	if _, err := p.Exchange(ctx, code, "verifier", "nonce-1"); err != nil {
+		t.Fatalf("Exchange after rotation: %v", err)
+	}
+	if got := issuer.JWKSRequests(); got != 2 {
+		t.Fatalf("JWKS requests = %d, want 2", got)
+	}
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	issuer := oidctest.NewIssuer(t, testClientID)
+	// Тот же сервер под другим именем: discovery отвечает, но называет другого издателя.
+	p := NewProvider(Config{
+		Issuer:     strings.Replace(issuer.URL, "127.0.0.1", "localhost", 1),
+		ClientID:   testClientID,
+		HTTPClient: issuer.Client(),
+	})
+
+	if _, err := p.Issuer(context.Background()); err == nil || !strings.Contains(err.Error(), "issuer mismatch") {
+		t.Fatalf("Issuer err = %v, want issuer mismatch", err)
+	}
+}
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-chat/internal/domain"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrAttachmentNotFound = errors.New("attachment not found")
+
+// AttachmentRepository определяет интерфейс для работы с метаданными вложений.
+// Прикрепление вложений к сообщению выполняет RoomRepository.SaveMessage.
+// Удаление записи о вложении ставит его файл в очередь orphaned_files (см. миграцию 000024).
+type AttachmentRepository interface {
+	Create(ctx context.Context, attachment *domain.Attachment) error
+	GetByID(ctx context.Context, id int64) (*domain.Attachment, error)
+	// DeleteUnlinked удаляет вложения, загруженные до before и так и не прикрепленные к сообщению.
+	DeleteUnlinked(ctx context.Context, before time.Time) (int64, error)
+	// OrphanedFiles возвращает до limit ключей файлов, которые нужно удалить из хранилища.
+	OrphanedFiles(ctx context.Context, limit int) ([]string, error)
+	// ForgetOrphanedFile убирает ключ из очереди после удаления файла из хранилища.
+	ForgetOrphanedFile(ctx context.Context, key string) error
+}
+
+type pgxAttachmentRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewAttachmentRepository(db *pgxpool.Pool) AttachmentRepository {
+	return &pgxAttachmentRepository{db: db}
+}
+
+const attachmentColumns = `id, room_id, user_id, message_id, storage_key, filename, content_type, size, created_at`
+
+func scanAttachment(row pgx.Row, a *domain.Attachment) error {
+	err := row.Scan(&a.ID, &a.RoomID, &a.UserID, &a.MessageID, &a.StorageKey, &a.Filename, &a.ContentType, &a.Size, &a.CreatedAt)
+	if err != nil {
+		return err
+	}
+	a.URL = domain.AttachmentPath + strconv.FormatInt(a.ID, 10)
+	return nil
+}
+
+func (r *pgxAttachmentRepository) Create(ctx context.Context, a *domain.Attachment) error {
+	query := `INSERT INTO attachments (room_id, user_id, storage_key, filename, content_type, size)
+	          VALUES ($1, $2, $3, $4, $5, $6)
+			  RETURNING id, created_at`
+
+	err := r.db.QueryRow(ctx, query, a.RoomID, a.UserID, a.StorageKey, a.Filename, a.ContentType, a.Size).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		return err
+	}
+	a.URL = domain.AttachmentPath + strconv.FormatInt(a.ID, 10)
+	return nil
+}
+
+func (r *pgxAttachmentRepository) GetByID(ctx context.Context, id int64) (*domain.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM attachments WHERE id = $1`
+
+	a := new(domain.Attachment)
+	if err := scanAttachment(r.db.QueryRow(ctx, query, id), a); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, err
+	}
+	return a, nil
+}
+
+func (r *pgxAttachmentRepository) DeleteUnlinked(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM attachments WHERE message_id IS NULL AND created_at < $1`
+
+	tag, err := r.db.Exec(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (r *pgxAttachmentRepository) OrphanedFiles(ctx context.Context, limit int) ([]string, error) {
+	query := `SELECT storage_key FROM orphaned_files ORDER BY created_at LIMIT $1`
+
+	rows, err := r.db.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+func (r *pgxAttachmentRepository) ForgetOrphanedFile(ctx context.Context, key string) error {
+	query := `DELETE FROM orphaned_files WHERE storage_key = $1`
+
+	_, err := r.db.Exec(ctx, query, key)
+	return err
+}
+
+// linkAttachments прикрепляет к сообщению вложения, которые загрузил его автор в ту же
+// комнату и которые еще ни к чему не прикреплены. Если хотя бы одно вложение не подходит,
+// возвращает ErrAttachmentNotFound, и транзакцию нужно откатить.
+func linkAttachments(ctx context.Context, tx pgx.Tx, message *domain.Message, ids []int64) error {
+	query := `UPDATE attachments SET message_id = $1
+	          WHERE id = ANY($2) AND room_id = $3 AND user_id = $4 AND message_id IS NULL
+			  RETURNING ` + attachmentColumns
+	rows, err := tx.Query(ctx, query, message.ID, ids, message.RoomID, message.UserID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	message.Attachments = nil
+	for rows.Next() {
+		var a domain.Attachment
+		if err := scanAttachment(rows, &a); err != nil {
+			return err
+		}
+		message.Attachments = append(message.Attachments, a)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(message.Attachments) != len(ids) {
+		return ErrAttachmentNotFound
+	}
+	return nil
+}
+
+// attachAttachments заполняет Attachments у сообщений одним запросом на всю страницу.
+func attachAttachments(ctx context.Context, db *pgxpool.Pool, messages []domain.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(messages))
+	byID := make(map[int64]*domain.Message, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].ID
+		byID[messages[i].ID] = &messages[i]
+	}
+
+	query := `SELECT ` + attachmentColumns + `
+	          FROM attachments
+			  WHERE message_id = ANY($1)
+			  ORDER BY id`
+	rows, err := db.Query(ctx, query, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a domain.Attachment
+		if err := scanAttachment(rows, &a); err != nil {
+			return err
+		}
+		if msg, ok := byID[*a.MessageID]; ok {
+			msg.Attachments = append(msg.Attachments, a)
+		}
+	}
+
+	return rows.Err()
+}
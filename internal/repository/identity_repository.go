@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-chat/internal/domain"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrIdentityNotFound = errors.New("identity not found")
+	// ErrOIDCLoginInvalid означает, что state не найден, истек или уже использован.
+	ErrOIDCLoginInvalid = errors.New("oidc login state is invalid or expired")
+	// ErrUsernameTaken означает, что имя пользователя уже занято.
+	ErrUsernameTaken = errors.New("username is taken")
+	// ErrEmailTaken означает, что адрес уже зарегистрирован.
+	ErrEmailTaken = errors.New("email is taken")
+)
+
+// IdentityRepository связывает пользователей с учетными записями у внешних провайдеров.
+type IdentityRepository interface {
+	// GetUser возвращает пользователя, привязанного к учетной записи провайдера.
+	GetUser(ctx context.Context, issuer, subject string) (*domain.User, error)
+	// Link привязывает учетную запись провайдера к пользователю.
+	Link(ctx context.Context, userID int64, issuer, subject string) error
+	// CreateUser создает пользователя с подтвержденным адресом и сразу привязывает учетную запись.
+	// Возвращает ErrUsernameTaken или ErrEmailTaken, если имя или адрес заняты.
+	CreateUser(ctx context.Context, user *domain.User, issuer, subject string) error
+
+	SaveLogin(ctx context.Context, stateHash []byte, nonce, codeVerifier string, expiresAt time.Time) error
+	// ConsumeLogin возвращает nonce и code_verifier начатого входа. Каждый state используется один раз.
+	ConsumeLogin(ctx context.Context, stateHash []byte) (nonce, codeVerifier string, err error)
+}
+
+type pgxIdentityRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewIdentityRepository(db *pgxpool.Pool) IdentityRepository {
+	return &pgxIdentityRepository{db: db}
+}
+
+func (r *pgxIdentityRepository) GetUser(ctx context.Context, issuer, subject string) (*domain.User, error) {
+	query := `SELECT u.id, u.username, u.email, u.password_hash, u.created_at, u.email_verified_at
+	          FROM user_identities i
+			  JOIN users u ON u.id = i.user_id
+			  WHERE i.issuer = $1 AND i.subject = $2`
+
+	user := new(domain.User)
+	err := r.db.QueryRow(ctx, query, issuer, subject).Scan(
+		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.EmailVerifiedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrIdentityNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *pgxIdentityRepository) Link(ctx context.Context, userID int64, issuer, subject string) error {
+	query := `INSERT INTO user_identities (user_id, issuer, subject) VALUES ($1, $2, $3)
+	          ON CONFLICT (issuer, subject) DO NOTHING`
+
+	_, err := r.db.Exec(ctx, query, userID, issuer, subject)
+	return err
+}
+
+func (r *pgxIdentityRepository) CreateUser(ctx context.Context, user *domain.User, issuer, subject string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `INSERT INTO users (username, email, password_hash, email_verified_at)
+	          VALUES ($1, $2, $3, now())
+			  RETURNING id, created_at, email_verified_at`
+	err = tx.QueryRow(ctx, query, user.Username, user.Email, user.PasswordHash).
+		Scan(&user.ID, &user.CreatedAt, &user.EmailVerifiedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			if pgErr.ConstraintName == "users_username_key" {
+				return ErrUsernameTaken
+			}
+			return ErrEmailTaken
+		}
+		return err
+	}
+
+	query = `INSERT INTO user_identities (user_id, issuer, subject) VALUES ($1, $2, $3)`
+	if _, err := tx.Exec(ctx, query, user.ID, issuer, subject); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *pgxIdentityRepository) SaveLogin(ctx context.Context, stateHash []byte, nonce, codeVerifier string, expiresAt time.Time) error {
+	query := `INSERT INTO oidc_logins (state_hash, nonce, code_verifier, expires_at) VALUES ($1, $2, $3, $4)`
+
+	_, err := r.db.Exec(ctx, query, stateHash, nonce, codeVerifier, expiresAt)
+	return err
+}
+
+func (r *pgxIdentityRepository) ConsumeLogin(ctx context.Context, stateHash []byte) (string, string, error) {
+	// Заодно удаляем брошенные входы, чтобы таблица не росла.
+	query := `WITH expired AS (
+	              DELETE FROM oidc_logins WHERE expires_at <= now() AND state_hash <> $1
+	          )
+	          DELETE FROM oidc_logins WHERE state_hash = $1
+			  RETURNING nonce, code_verifier, expires_at > now()`
+
+	var (
+		nonce, codeVerifier string
+		active              bool
+	)
+	if err := r.db.QueryRow(ctx, query, stateHash).Scan(&nonce, &codeVerifier, &active); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", ErrOIDCLoginInvalid
+		}
+		return "", "", err
+	}
+	if !active {
+		return "", "", ErrOIDCLoginInvalid
+	}
+	return nonce, codeVerifier, nil
+}
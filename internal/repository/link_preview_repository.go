@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-chat/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrLinkPreviewNotFound = errors.New("link preview not found")
+
+// LinkPreviewRepository определяет интерфейс для кэша карточек ссылок
+// и их привязки к сообщениям.
+type LinkPreviewRepository interface {
+	Get(ctx context.Context, url string) (*domain.LinkPreview, error)
+	Save(ctx context.Context, preview *domain.LinkPreview) error
+	SetMessagePreviews(ctx context.Context, message *domain.Message, urls []string) (bool, error)
+}
+
+type pgxLinkPreviewRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewLinkPreviewRepository(db *pgxpool.Pool) LinkPreviewRepository {
+	return &pgxLinkPreviewRepository{db: db}
+}
+
+const linkPreviewColumns = `url, title, description, image_url, site_name, fetched_at`
+
+func scanLinkPreview(row pgx.Row, p *domain.LinkPreview) error {
+	return row.Scan(&p.URL, &p.Title, &p.Description, &p.ImageURL, &p.SiteName, &p.FetchedAt)
+}
+
+func (r *pgxLinkPreviewRepository) Get(ctx context.Context, url string) (*domain.LinkPreview, error) {
+	query := `SELECT ` + linkPreviewColumns + ` FROM link_previews WHERE url = $1`
+
+	p := new(domain.LinkPreview)
+	if err := scanLinkPreview(r.db.QueryRow(ctx, query, url), p); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrLinkPreviewNotFound
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+// Save добавляет карточку в кэш или обновляет уже закэшированную.
+func (r *pgxLinkPreviewRepository) Save(ctx context.Context, p *domain.LinkPreview) error {
+	query := `INSERT INTO link_previews (url, title, description, image_url, site_name)
+	          VALUES ($1, $2, $3, $4, $5)
+			  ON CONFLICT (url) DO UPDATE
+			  SET title = EXCLUDED.title, description = EXCLUDED.description,
+			      image_url = EXCLUDED.image_url, site_name = EXCLUDED.site_name, fetched_at = now()
+			  RETURNING fetched_at`
+
+	return r.db.QueryRow(ctx, query, p.URL, p.Title, p.Description, p.ImageURL, p.SiteName).Scan(&p.FetchedAt)
+}
+
+// SetMessagePreviews заменяет карточки сообщения на карточки urls (они уже должны быть
+// в кэше). Если текст сообщения успел измениться или оно удалено, ничего не делает
+// и возвращает false: карточки относятся к устаревшему тексту.
+func (r *pgxLinkPreviewRepository) SetMessagePreviews(ctx context.Context, message *domain.Message, urls []string) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Блокировка строки не дает правке сообщения проскочить между проверкой и записью.
+	var exists int
+	err = tx.QueryRow(ctx, `SELECT 1 FROM messages WHERE id = $1 AND content = $2 AND deleted_at IS NULL FOR UPDATE`,
+		message.ID, message.Content).Scan(&exists)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM message_link_previews WHERE message_id = $1`, message.ID); err != nil {
+		return false, err
+	}
+	query := `INSERT INTO message_link_previews (message_id, url, position)
+	          SELECT $1, u.url, u.position FROM unnest($2::varchar[]) WITH ORDINALITY AS u(url, position)`
+	if _, err := tx.Exec(ctx, query, message.ID, urls); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// attachLinkPreviews заполняет LinkPreviews у сообщений одним запросом на всю страницу.
+func attachLinkPreviews(ctx context.Context, db *pgxpool.Pool, messages []domain.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(messages))
+	byID := make(map[int64]*domain.Message, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].ID
+		byID[messages[i].ID] = &messages[i]
+	}
+
+	query := `SELECT mlp.message_id, lp.url, lp.title, lp.description, lp.image_url, lp.site_name, lp.fetched_at
+	          FROM message_link_previews mlp
+			  JOIN link_previews lp ON lp.url = mlp.url
+			  WHERE mlp.message_id = ANY($1)
+			  ORDER BY mlp.message_id, mlp.position`
+	rows, err := db.Query(ctx, query, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int64
+		var p domain.LinkPreview
+		if err := rows.Scan(&messageID, &p.URL, &p.Title, &p.Description, &p.ImageURL, &p.SiteName, &p.FetchedAt); err != nil {
+			return err
+		}
+		if msg, ok := byID[messageID]; ok {
+			msg.LinkPreviews = append(msg.LinkPreviews, p)
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"go-chat/internal/domain"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// LoginThrottleRepository считает неудачные входы и ведет их журнал.
+type LoginThrottleRepository interface {
+	// LockedUntil возвращает самый поздний срок блокировки среди ключей.
+	// Нулевое время, если ни один ключ не заблокирован.
+	LockedUntil(ctx context.Context, keys []string) (time.Time, error)
+	// RecordFailure увеличивает счетчик неудач ключа и возвращает его новое значение.
+	// Счетчик, не менявшийся дольше window, начинается заново.
+	RecordFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	// Reset сбрасывает счетчик ключа после успешного входа.
+	Reset(ctx context.Context, key string) error
+	LogFailure(ctx context.Context, failure *domain.FailedLogin) error
+}
+
+type pgxLoginThrottleRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewLoginThrottleRepository(db *pgxpool.Pool) LoginThrottleRepository {
+	return &pgxLoginThrottleRepository{db: db}
+}
+
+func (r *pgxLoginThrottleRepository) LockedUntil(ctx context.Context, keys []string) (time.Time, error) {
+	query := `SELECT max(locked_until) FROM login_throttles WHERE key = ANY($1) AND locked_until > now()`
+
+	var until *time.Time
+	if err := r.db.QueryRow(ctx, query, keys).Scan(&until); err != nil {
+		return time.Time{}, err
+	}
+	if until == nil {
+		return time.Time{}, nil
+	}
+	return *until, nil
+}
+
+func (r *pgxLoginThrottleRepository) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	query := `INSERT INTO login_throttles (key, failures) VALUES ($1, 1)
+	          ON CONFLICT (key) DO UPDATE
+			  SET failures = CASE WHEN login_throttles.last_failed_at < $2 THEN 1 ELSE login_throttles.failures + 1 END,
+			      last_failed_at = now()
+			  RETURNING failures`
+
+	var failures int
+	err := r.db.QueryRow(ctx, query, key, time.Now().Add(-window)).Scan(&failures)
+	return failures, err
+}
+
+func (r *pgxLoginThrottleRepository) Lock(ctx context.Context, key string, until time.Time) error {
+	query := `UPDATE login_throttles SET locked_until = GREATEST(locked_until, $2) WHERE key = $1`
+
+	_, err := r.db.Exec(ctx, query, key, until)
+	return err
+}
+
+func (r *pgxLoginThrottleRepository) Reset(ctx context.Context, key string) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM login_throttles WHERE key = $1`, key)
+	return err
+}
+
+func (r *pgxLoginThrottleRepository) LogFailure(ctx context.Context, failure *domain.FailedLogin) error {
+	query := `INSERT INTO failed_logins (email, user_id, ip, user_agent, reason)
+	          VALUES ($1, $2, $3, $4, $5)
+			  RETURNING id, created_at`
+
+	return r.db.QueryRow(ctx, query, failure.Email, failure.UserID, failure.IP, failure.UserAgent, failure.Reason).
+		Scan(&failure.ID, &failure.CreatedAt)
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"go-chat/internal/domain"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ReactionRepository определяет интерфейс для работы с реакциями на сообщения.
+type ReactionRepository interface {
+	// AddReaction добавляет реакцию и возвращает число реакций этим эмодзи.
+	// Повторная реакция тем же эмодзи ничего не меняет, и added равно false.
+	AddReaction(ctx context.Context, messageID, userID int64, emoji string) (count int, added bool, err error)
+	// RemoveReaction удаляет реакцию пользователя и возвращает оставшееся число реакций этим эмодзи.
+	// Если такой реакции не было, removed равно false.
+	RemoveReaction(ctx context.Context, messageID, userID int64, emoji string) (count int, removed bool, err error)
+}
+
+type pgxReactionRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewReactionRepository(db *pgxpool.Pool) ReactionRepository {
+	return &pgxReactionRepository{db: db}
+}
+
+func (r *pgxReactionRepository) AddReaction(ctx context.Context, messageID, userID int64, emoji string) (int, bool, error) {
+	query := `INSERT INTO message_reactions (message_id, user_id, emoji) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+
+	tag, err := r.db.Exec(ctx, query, messageID, userID, emoji)
+	if err != nil {
+		return 0, false, err
+	}
+	count, err := r.count(ctx, messageID, emoji)
+	return count, tag.RowsAffected() > 0, err
+}
+
+func (r *pgxReactionRepository) RemoveReaction(ctx context.Context, messageID, userID int64, emoji string) (int, bool, error) {
+	query := `DELETE FROM message_reactions WHERE message_id = $1 AND user_id = $2 AND emoji = $3`
+
+	tag, err := r.db.Exec(ctx, query, messageID, userID, emoji)
+	if err != nil {
+		return 0, false, err
+	}
+	count, err := r.count(ctx, messageID, emoji)
+	return count, tag.RowsAffected() > 0, err
+}
+
+func (r *pgxReactionRepository) count(ctx context.Context, messageID int64, emoji string) (int, error) {
+	query := `SELECT count(*) FROM message_reactions WHERE message_id = $1 AND emoji = $2`
+
+	var count int
+	err := r.db.QueryRow(ctx, query, messageID, emoji).Scan(&count)
+	return count, err
+}
+
+// attachReactions заполняет Reactions у сообщений одним запросом на всю страницу.
+// Эмодзи упорядочены по времени первой реакции.
+func attachReactions(ctx context.Context, db *pgxpool.Pool, messages []domain.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(messages))
+	byID := make(map[int64]*domain.Message, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].ID
+		byID[messages[i].ID] = &messages[i]
+	}
+
+	query := `SELECT message_id, emoji, count(*)
+	          FROM message_reactions
+			  WHERE message_id = ANY($1)
+			  GROUP BY message_id, emoji
+			  ORDER BY message_id, min(created_at)`
+	rows, err := db.Query(ctx, query, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			messageID int64
+			reaction  domain.ReactionCount
+		)
+		if err := rows.Scan(&messageID, &reaction.Emoji, &reaction.Count); err != nil {
+			return err
+		}
+		if msg, ok := byID[messageID]; ok {
+			msg.Reactions = append(msg.Reactions, reaction)
+		}
+	}
+
+	return rows.Err()
+}
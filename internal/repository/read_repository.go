@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-chat/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ReadRepository определяет интерфейс для работы с позициями прочтения комнат.
+type ReadRepository interface {
+	MarkRead(ctx context.Context, roomID, userID, messageID int64) (marker *domain.ReadMarker, advanced bool, err error)
+	GetReceipts(ctx context.Context, roomID int64) ([]domain.ReadReceipt, error)
+	GetMessageReaders(ctx context.Context, message *domain.Message) ([]domain.ReadReceipt, error)
+}
+
+type pgxReadRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewReadRepository(db *pgxpool.Pool) ReadRepository {
+	return &pgxReadRepository{db: db}
+}
+
+// MarkRead отмечает комнату прочитанной до сообщения messageID включительно. Отметка
+// только продвигается вперед: более старое сообщение ее не меняет, и тогда advanced
+// равен false. Возвращает ErrMessageNotFound, если сообщения нет в комнате.
+func (r *pgxReadRepository) MarkRead(ctx context.Context, roomID, userID, messageID int64) (*domain.ReadMarker, bool, error) {
+	query := `WITH prev AS (
+	              SELECT last_read_message_id FROM room_reads WHERE room_id = $1 AND user_id = $2
+	          )
+	          INSERT INTO room_reads (room_id, user_id, last_read_message_id)
+	          SELECT m.room_id, $2, m.id FROM messages m WHERE m.room_id = $1 AND m.id = $3
+			  ON CONFLICT (room_id, user_id) DO UPDATE
+			  SET last_read_message_id = GREATEST(room_reads.last_read_message_id, EXCLUDED.last_read_message_id),
+			      updated_at = now()
+			  RETURNING last_read_message_id, COALESCE((SELECT last_read_message_id FROM prev), 0)`
+
+	marker := &domain.ReadMarker{RoomID: roomID, UserID: userID}
+	var prev int64
+	err := r.db.QueryRow(ctx, query, roomID, userID, messageID).Scan(&marker.LastReadMessageID, &prev)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	countQuery := `SELECT (` + unreadCountQuery + `)
+	               FROM (SELECT $2::bigint AS room_id, $3::bigint AS last_read_message_id) rr`
+	if err := r.db.QueryRow(ctx, countQuery, userID, roomID, marker.LastReadMessageID).Scan(&marker.UnreadCount); err != nil {
+		return nil, false, err
+	}
+
+	return marker, marker.LastReadMessageID > prev, nil
+}
+
+// GetReceipts возвращает позиции прочтения всех участников комнаты, которые что-либо читали.
+func (r *pgxReadRepository) GetReceipts(ctx context.Context, roomID int64) ([]domain.ReadReceipt, error) {
+	query := `SELECT rr.room_id, rr.user_id, u.username, rr.last_read_message_id, rr.updated_at
+	          FROM room_reads rr
+			  JOIN room_members rm ON rm.room_id = rr.room_id AND rm.user_id = rr.user_id
+			  JOIN users u ON u.id = rr.user_id
+			  WHERE rr.room_id = $1
+			  ORDER BY rr.last_read_message_id DESC, rr.updated_at`
+	return r.queryReceipts(ctx, query, roomID)
+}
+
+// GetMessageReaders возвращает участников, дочитавших комнату до сообщения, кроме его автора.
+func (r *pgxReadRepository) GetMessageReaders(ctx context.Context, message *domain.Message) ([]domain.ReadReceipt, error) {
+	query := `SELECT rr.room_id, rr.user_id, u.username, rr.last_read_message_id, rr.updated_at
+	          FROM room_reads rr
+			  JOIN room_members rm ON rm.room_id = rr.room_id AND rm.user_id = rr.user_id
+			  JOIN users u ON u.id = rr.user_id
+			  WHERE rr.room_id = $1 AND rr.last_read_message_id >= $2 AND rr.user_id <> $3
+			  ORDER BY rr.updated_at`
+	return r.queryReceipts(ctx, query, message.RoomID, message.ID, message.UserID)
+}
+
+func (r *pgxReadRepository) queryReceipts(ctx context.Context, query string, args ...interface{}) ([]domain.ReadReceipt, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	receipts := []domain.ReadReceipt{}
+	for rows.Next() {
+		var rc domain.ReadReceipt
+		if err := rows.Scan(&rc.RoomID, &rc.UserID, &rc.Username, &rc.LastReadMessageID, &rc.ReadAt); err != nil {
+			return nil, err
+		}
+		receipts = append(receipts, rc)
+	}
+
+	return receipts, rows.Err()
+}
@@ -2,17 +2,76 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"go-chat/internal/domain"
+	"html"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var (
+	ErrRoomNotFound    = errors.New("room not found")
+	ErrNotMember       = errors.New("user is not a member of the room")
+	ErrMessageNotFound = errors.New("message not found")
+	// ErrParentNotFound - сообщение, на которое отвечают, не найдено в комнате,
+	// удалено или само является ответом.
+	ErrParentNotFound = errors.New("parent message not found")
+)
+
 // RoomRepository определяет интерфейс для работы с комнатами и сообщениями.
 type RoomRepository interface {
-	CreateRoom(ctx context.Context, room *domain.Room) error
-	GetRooms(ctx context.Context) ([]domain.Room, error)
-	SaveMessage(ctx context.Context, message *domain.Message) error
-	GetMessagesByRoomID(ctx context.Context, roomID int64) ([]domain.Message, error)
+	CreateRoom(ctx context.Context, room *domain.Room, creatorID int64) error
+	GetRoom(ctx context.Context, roomID int64) (*domain.Room, error)
+	GetRooms(ctx context.Context, userID int64) ([]domain.RoomSummary, error)
+	UpdateRoom(ctx context.Context, room *domain.Room) error
+	DeleteRoom(ctx context.Context, roomID int64) error
+	GetMemberRole(ctx context.Context, roomID, userID int64) (domain.Role, error)
+	AddMember(ctx context.Context, roomID, userID int64) error
+	SetMemberRole(ctx context.Context, roomID, userID int64, role domain.Role) error
+	RemoveMember(ctx context.Context, roomID, userID int64) error
+	BanMember(ctx context.Context, roomID, userID, bannedBy int64) error
+	UnbanMember(ctx context.Context, roomID, userID int64) error
+	IsBanned(ctx context.Context, roomID, userID int64) (bool, error)
+	GetMembers(ctx context.Context, roomID int64) ([]domain.RoomMember, error)
+	FindOrCreateDirectRoom(ctx context.Context, userID, otherUserID int64) (room *domain.Room, created bool, err error)
+	GetDirectConversations(ctx context.Context, userID int64) ([]domain.DirectConversation, error)
+	SaveMessage(ctx context.Context, message *domain.Message, attachmentIDs []int64) error
+	GetMessage(ctx context.Context, roomID, messageID int64) (*domain.Message, error)
+	UpdateMessageContent(ctx context.Context, message *domain.Message) error
+	DeleteMessage(ctx context.Context, message *domain.Message) error
+	GetMessagesByRoomID(ctx context.Context, roomID int64, q MessageQuery) ([]domain.Message, error)
+	SearchMessages(ctx context.Context, userID int64, q SearchQuery) ([]domain.SearchResult, error)
+}
+
+// SearchQuery задает параметры полнотекстового поиска сообщений.
+type SearchQuery struct {
+	// Text - поисковый запрос в синтаксисе websearch_to_tsquery: слова, "фразы", -исключения, or.
+	Text string
+	// RoomID ограничивает поиск одной комнатой. Если не задан, поиск идет по всем комнатам,
+	// доступным пользователю.
+	RoomID int64
+	Limit  int
+	Offset int
+}
+
+// MessageQuery задает курсор и размер страницы при выборке сообщений.
+// Нулевые BeforeID и AfterID означают отсутствие ограничения.
+type MessageQuery struct {
+	BeforeID int64
+	AfterID  int64
+	// Forward выбирает самые старые сообщения после AfterID, а не самые новые.
+	// Нужен отдельно от AfterID, потому что after=0 означает "с начала комнаты".
+	Forward bool
+	Limit   int
+	// ParentID выбирает ответы в ветке сообщения. Если он не задан,
+	// выбираются только сообщения верхнего уровня.
+	ParentID int64
+	// WithReplies выбирает и сообщения верхнего уровня, и ответы; ParentID игнорируется.
+	WithReplies bool
 }
 
 type pgxRoomRepository struct {
@@ -23,66 +82,609 @@ func NewRoomRepository(db *pgxpool.Pool) RoomRepository {
 	return &pgxRoomRepository{db: db}
 }
 
-func (r *pgxRoomRepository) CreateRoom(ctx context.Context, room *domain.Room) error {
-	query := `INSERT INTO rooms (name) VALUES ($1) RETURNING id, created_at`
-
-	err := r.db.QueryRow(ctx, query, room.Name).Scan(&room.ID, &room.CreatedAt)
+// CreateRoom создает комнату и делает ее создателя владельцем и первым участником.
+func (r *pgxRoomRepository) CreateRoom(ctx context.Context, room *domain.Room, creatorID int64) error {
+	tx, err := r.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
 
-	return nil
+	query := `INSERT INTO rooms (name, visibility, owner_id, read_receipts) VALUES ($1, $2, $3, $4) RETURNING id, kind, created_at`
+	if err := tx.QueryRow(ctx, query, room.Name, room.Visibility, creatorID, room.ReadReceipts).Scan(&room.ID, &room.Kind, &room.CreatedAt); err != nil {
+		return err
+	}
+	room.OwnerID = &creatorID
+
+	query = `INSERT INTO room_members (room_id, user_id, role) VALUES ($1, $2, $3)`
+	if _, err := tx.Exec(ctx, query, room.ID, creatorID, domain.RoleOwner); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
-func (r *pgxRoomRepository) GetRooms(ctx context.Context) ([]domain.Room, error) {
-	query := `SELECT id, name, created_at FROM rooms ORDER BY created_at DESC`
-	rows, err := r.db.Query(ctx, query)
+func (r *pgxRoomRepository) GetRoom(ctx context.Context, roomID int64) (*domain.Room, error) {
+	query := `SELECT id, name, kind, visibility, owner_id, read_receipts, created_at FROM rooms WHERE id = $1`
+
+	room := new(domain.Room)
+	err := r.db.QueryRow(ctx, query, roomID).Scan(&room.ID, &room.Name, &room.Kind, &room.Visibility, &room.OwnerID, &room.ReadReceipts, &room.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRoomNotFound
+		}
+		return nil, err
+	}
+
+	return room, nil
+}
+
+// unreadCountQuery считает непрочитанные пользователем $1 сообщения комнаты rr.room_id:
+// чужие, не удаленные, после его отметки и после его вступления в комнату. У тех, кто
+// не состоит в комнате, непрочитанных нет.
+const unreadCountQuery = `SELECT count(*)
+	FROM messages m
+	JOIN room_members rm ON rm.room_id = m.room_id AND rm.user_id = $1
+	WHERE m.room_id = rr.room_id
+	  AND m.id > rr.last_read_message_id
+	  AND m.user_id <> $1
+	  AND m.deleted_at IS NULL
+	  AND m.created_at >= rm.joined_at`
+
+// GetRooms возвращает публичные комнаты и приватные комнаты, в которых состоит пользователь,
+// с его позицией прочтения, числом непрочитанных и последним сообщением.
+// Личные переписки сюда не входят, их возвращает GetDirectConversations.
+func (r *pgxRoomRepository) GetRooms(ctx context.Context, userID int64) ([]domain.RoomSummary, error) {
+	query := `SELECT r.id, r.name, r.kind, r.visibility, r.owner_id, r.read_receipts, r.created_at,
+	                 rr.last_read_message_id, (` + unreadCountQuery + `),
+	                 lm.id, lm.user_id, lu.username, lm.content, lm.created_at
+	          FROM rooms r
+			  CROSS JOIN LATERAL (
+			      SELECT r.id AS room_id, COALESCE(MAX(last_read_message_id), 0) AS last_read_message_id
+			      FROM room_reads WHERE room_id = r.id AND user_id = $1
+			  ) rr
+			  LEFT JOIN LATERAL (
+			      SELECT m.id, m.user_id, m.content, m.created_at
+			      FROM messages m
+			      WHERE m.room_id = r.id AND m.deleted_at IS NULL
+			      ORDER BY m.id DESC
+			      LIMIT 1
+			  ) lm ON true
+			  LEFT JOIN users lu ON lu.id = lm.user_id
+			  WHERE r.kind = 'room'
+			    AND (r.visibility = 'public'
+			         OR EXISTS (SELECT 1 FROM room_members rm WHERE rm.room_id = r.id AND rm.user_id = $1))
+			  ORDER BY r.created_at DESC`
+	rows, err := r.db.Query(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var rooms []domain.Room
+	var rooms []domain.RoomSummary
 	for rows.Next() {
-		var room domain.Room
-		if err := rows.Scan(&room.ID, &room.Name, &room.CreatedAt); err != nil {
+		var (
+			room domain.RoomSummary
+			last lastMessageColumns
+		)
+		err := rows.Scan(&room.ID, &room.Name, &room.Kind, &room.Visibility, &room.OwnerID, &room.ReadReceipts, &room.CreatedAt,
+			&room.LastReadMessageID, &room.UnreadCount,
+			&last.id, &last.userID, &last.username, &last.content, &last.createdAt)
+		if err != nil {
 			return nil, err
 		}
+		room.LastMessage = last.message(room.ID)
 		rooms = append(rooms, room)
 	}
 
 	return rooms, rows.Err()
 }
 
-func (r *pgxRoomRepository) SaveMessage(ctx context.Context, message *domain.Message) error {
-	query := `INSERT INTO messages (room_id, user_id, content) 
-	          VALUES ($1, $2, $3) 
-			  RETURNING id, created_at`
+// lastMessageColumns принимает колонки последнего сообщения из LEFT JOIN,
+// которые пусты, если сообщений нет.
+type lastMessageColumns struct {
+	id        *int64
+	userID    *int64
+	username  *string
+	content   *string
+	createdAt *time.Time
+}
 
-	err := r.db.QueryRow(ctx, query, message.RoomID, message.UserID, message.Content).Scan(&message.ID, &message.CreatedAt)
+func (c *lastMessageColumns) message(roomID int64) *domain.Message {
+	if c.id == nil {
+		return nil
+	}
+	return &domain.Message{
+		ID:        *c.id,
+		RoomID:    roomID,
+		UserID:    *c.userID,
+		Username:  *c.username,
+		Content:   *c.content,
+		CreatedAt: *c.createdAt,
+	}
+}
+
+func (r *pgxRoomRepository) UpdateRoom(ctx context.Context, room *domain.Room) error {
+	query := `UPDATE rooms SET name = $2, read_receipts = $3 WHERE id = $1`
+
+	tag, err := r.db.Exec(ctx, query, room.ID, room.Name, room.ReadReceipts)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRoomNotFound
+	}
+	return nil
+}
+
+// DeleteRoom удаляет комнату вместе с ее участниками и сообщениями.
+func (r *pgxRoomRepository) DeleteRoom(ctx context.Context, roomID int64) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM rooms WHERE id = $1`, roomID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRoomNotFound
+	}
+	return nil
+}
+
+// GetMemberRole возвращает роль пользователя в комнате или ErrNotMember.
+func (r *pgxRoomRepository) GetMemberRole(ctx context.Context, roomID, userID int64) (domain.Role, error) {
+	query := `SELECT role FROM room_members WHERE room_id = $1 AND user_id = $2`
+
+	var role domain.Role
+	err := r.db.QueryRow(ctx, query, roomID, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrNotMember
+		}
+		return "", err
+	}
+	return role, nil
+}
+
+// AddMember добавляет пользователя в комнату. Повторное добавление ничего не меняет.
+func (r *pgxRoomRepository) AddMember(ctx context.Context, roomID, userID int64) error {
+	query := `INSERT INTO room_members (room_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+
+	_, err := r.db.Exec(ctx, query, roomID, userID)
 	return err
 }
 
-func (r *pgxRoomRepository) GetMessagesByRoomID(ctx context.Context, roomID int64) ([]domain.Message, error) {
-	query := `SELECT m.id, m.room_id, m.user_id, u.username, m.content, m.created_at 
+func (r *pgxRoomRepository) SetMemberRole(ctx context.Context, roomID, userID int64, role domain.Role) error {
+	query := `UPDATE room_members SET role = $3 WHERE room_id = $1 AND user_id = $2`
+
+	tag, err := r.db.Exec(ctx, query, roomID, userID, role)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotMember
+	}
+	return nil
+}
+
+func (r *pgxRoomRepository) RemoveMember(ctx context.Context, roomID, userID int64) error {
+	query := `DELETE FROM room_members WHERE room_id = $1 AND user_id = $2`
+
+	tag, err := r.db.Exec(ctx, query, roomID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotMember
+	}
+	return nil
+}
+
+// BanMember запрещает пользователю доступ к комнате и исключает его, если он в ней состоит.
+// Запретить можно и не-участника: в публичную комнату пишут, не вступая в нее.
+func (r *pgxRoomRepository) BanMember(ctx context.Context, roomID, userID, bannedBy int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM room_members WHERE room_id = $1 AND user_id = $2`, roomID, userID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO room_bans (room_id, user_id, banned_by) VALUES ($1, $2, $3)
+	          ON CONFLICT (room_id, user_id) DO UPDATE SET banned_by = EXCLUDED.banned_by, created_at = now()`
+	if _, err := tx.Exec(ctx, query, roomID, userID, bannedBy); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UnbanMember снимает запрет на возвращение в комнату. Если запрета не было, ничего не делает.
+func (r *pgxRoomRepository) UnbanMember(ctx context.Context, roomID, userID int64) error {
+	query := `DELETE FROM room_bans WHERE room_id = $1 AND user_id = $2`
+
+	_, err := r.db.Exec(ctx, query, roomID, userID)
+	return err
+}
+
+// IsBanned сообщает, исключен ли пользователь из комнаты.
+func (r *pgxRoomRepository) IsBanned(ctx context.Context, roomID, userID int64) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM room_bans WHERE room_id = $1 AND user_id = $2)`
+
+	var banned bool
+	err := r.db.QueryRow(ctx, query, roomID, userID).Scan(&banned)
+	return banned, err
+}
+
+func (r *pgxRoomRepository) GetMembers(ctx context.Context, roomID int64) ([]domain.RoomMember, error) {
+	query := `SELECT rm.room_id, rm.user_id, u.username, rm.role, rm.joined_at
+	          FROM room_members rm
+			  JOIN users u ON rm.user_id = u.id
+			  WHERE rm.room_id = $1
+			  ORDER BY rm.joined_at ASC`
+	rows, err := r.db.Query(ctx, query, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []domain.RoomMember{}
+	for rows.Next() {
+		var member domain.RoomMember
+		if err := rows.Scan(&member.RoomID, &member.UserID, &member.Username, &member.Role, &member.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+// FindOrCreateDirectRoom возвращает личную переписку двух пользователей, создавая ее при первом обращении.
+func (r *pgxRoomRepository) FindOrCreateDirectRoom(ctx context.Context, userID, otherUserID int64) (*domain.Room, bool, error) {
+	user1, user2 := min(userID, otherUserID), max(userID, otherUserID)
+
+	room, err := r.getDirectRoom(ctx, user1, user2)
+	if err == nil || !errors.Is(err, ErrRoomNotFound) {
+		return room, false, err
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	room = &domain.Room{Kind: domain.RoomKindDirect, Visibility: domain.RoomPrivate}
+	query := `INSERT INTO rooms (name, kind, visibility) VALUES ('', $1, $2) RETURNING id, read_receipts, created_at`
+	if err := tx.QueryRow(ctx, query, room.Kind, room.Visibility).Scan(&room.ID, &room.ReadReceipts, &room.CreatedAt); err != nil {
+		return nil, false, err
+	}
+
+	query = `INSERT INTO direct_rooms (room_id, user1_id, user2_id) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+	tag, err := tx.Exec(ctx, query, room.ID, user1, user2)
+	if err != nil {
+		return nil, false, err
+	}
+	if tag.RowsAffected() == 0 {
+		// Переписку успел создать параллельный запрос.
+		tx.Rollback(ctx)
+		room, err := r.getDirectRoom(ctx, user1, user2)
+		return room, false, err
+	}
+
+	query = `INSERT INTO room_members (room_id, user_id, role) VALUES ($1, $2, $4), ($1, $3, $4)`
+	if _, err := tx.Exec(ctx, query, room.ID, user1, user2, domain.RoleMember); err != nil {
+		return nil, false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, false, err
+	}
+	return room, true, nil
+}
+
+func (r *pgxRoomRepository) getDirectRoom(ctx context.Context, user1, user2 int64) (*domain.Room, error) {
+	var roomID int64
+	query := `SELECT room_id FROM direct_rooms WHERE user1_id = $1 AND user2_id = $2`
+	if err := r.db.QueryRow(ctx, query, user1, user2).Scan(&roomID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRoomNotFound
+		}
+		return nil, err
+	}
+	return r.GetRoom(ctx, roomID)
+}
+
+// GetDirectConversations возвращает личные переписки пользователя, начиная с самых недавних.
+func (r *pgxRoomRepository) GetDirectConversations(ctx context.Context, userID int64) ([]domain.DirectConversation, error) {
+	query := `SELECT d.room_id, u.id, u.username, r.created_at,
+	                 rr.last_read_message_id, (` + unreadCountQuery + `),
+	                 lm.id, lm.user_id, lu.username, lm.content, lm.created_at
+	          FROM direct_rooms d
+			  JOIN rooms r ON r.id = d.room_id
+			  JOIN users u ON u.id = CASE WHEN d.user1_id = $1 THEN d.user2_id ELSE d.user1_id END
+			  CROSS JOIN LATERAL (
+			      SELECT d.room_id, COALESCE(MAX(last_read_message_id), 0) AS last_read_message_id
+			      FROM room_reads WHERE room_id = d.room_id AND user_id = $1
+			  ) rr
+			  LEFT JOIN LATERAL (
+			      SELECT m.id, m.user_id, m.content, m.created_at
+			      FROM messages m
+			      WHERE m.room_id = d.room_id AND m.deleted_at IS NULL
+			      ORDER BY m.id DESC
+			      LIMIT 1
+			  ) lm ON true
+			  LEFT JOIN users lu ON lu.id = lm.user_id
+			  WHERE d.user1_id = $1 OR d.user2_id = $1
+			  ORDER BY COALESCE(lm.created_at, r.created_at) DESC`
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := []domain.DirectConversation{}
+	for rows.Next() {
+		var (
+			conv domain.DirectConversation
+			last lastMessageColumns
+		)
+		err := rows.Scan(&conv.RoomID, &conv.OtherUser.ID, &conv.OtherUser.Username, &conv.CreatedAt,
+			&conv.LastReadMessageID, &conv.UnreadCount,
+			&last.id, &last.userID, &last.username, &last.content, &last.createdAt)
+		if err != nil {
+			return nil, err
+		}
+		conv.LastMessage = last.message(conv.RoomID)
+		conversations = append(conversations, conv)
+	}
+
+	return conversations, rows.Err()
+}
+
+// SaveMessage сохраняет сообщение и прикрепляет к нему загруженные ранее вложения.
+// Если задан ParentID, сообщение становится ответом в ветке, и счетчик ответов
+// родителя увеличивается в той же транзакции.
+func (r *pgxRoomRepository) SaveMessage(ctx context.Context, message *domain.Message, attachmentIDs []int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `INSERT INTO messages (room_id, user_id, content, parent_id)
+	          VALUES ($1, $2, $3, $4)
+			  RETURNING id, created_at`
+
+	err = tx.QueryRow(ctx, query, message.RoomID, message.UserID, message.Content, message.ParentID).Scan(&message.ID, &message.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if message.ParentID != nil {
+		// Ветки одноуровневые: ответить можно только на сообщение верхнего уровня.
+		query = `UPDATE messages SET reply_count = reply_count + 1, last_reply_at = $3
+		         WHERE id = $1 AND room_id = $2 AND parent_id IS NULL AND deleted_at IS NULL`
+		tag, err := tx.Exec(ctx, query, *message.ParentID, message.RoomID, message.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrParentNotFound
+		}
+	}
+
+	if len(attachmentIDs) > 0 {
+		if err := linkAttachments(ctx, tx, message, attachmentIDs); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// messageColumns - столбцы сообщения для scanMessage. Запрос должен соединять
+// messages m с users u по автору.
+const messageColumns = `m.id, m.room_id, m.user_id, u.username, m.content, m.created_at, m.edited_at, m.deleted_at,
+	m.parent_id, m.reply_count, m.last_reply_at`
+
+// scanMessage читает столбцы messageColumns в msg, а следующие за ними - в extra.
+func scanMessage(row pgx.Row, msg *domain.Message, extra ...interface{}) error {
+	dest := []interface{}{&msg.ID, &msg.RoomID, &msg.UserID, &msg.Username, &msg.Content, &msg.CreatedAt, &msg.EditedAt, &msg.DeletedAt,
+		&msg.ParentID, &msg.ReplyCount, &msg.LastReplyAt}
+	return row.Scan(append(dest, extra...)...)
+}
+
+func (r *pgxRoomRepository) GetMessage(ctx context.Context, roomID, messageID int64) (*domain.Message, error) {
+	query := `SELECT ` + messageColumns + `
 	          FROM messages m
 			  JOIN users u ON m.user_id = u.id
-			  WHERE m.room_id = $1 
-			  ORDER BY m.created_at ASC`
-	rows, err := r.db.Query(ctx, query, roomID)
+			  WHERE m.room_id = $1 AND m.id = $2`
+
+	messages := make([]domain.Message, 1)
+	if err := scanMessage(r.db.QueryRow(ctx, query, roomID, messageID), &messages[0]); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+
+	if err := r.attachDetails(ctx, messages); err != nil {
+		return nil, err
+	}
+	return &messages[0], nil
+}
+
+// UpdateMessageContent заменяет текст сообщения и отмечает его отредактированным.
+// Удаленные сообщения не редактируются.
+func (r *pgxRoomRepository) UpdateMessageContent(ctx context.Context, message *domain.Message) error {
+	// Карточки ссылок относятся к старому тексту и удаляются вместе с правкой.
+	query := `WITH updated AS (
+	              UPDATE messages SET content = $3, edited_at = now()
+	              WHERE room_id = $1 AND id = $2 AND deleted_at IS NULL
+	              RETURNING id, edited_at
+	          ), unlinked AS (
+	              DELETE FROM message_link_previews WHERE message_id IN (SELECT id FROM updated)
+	          )
+	          SELECT edited_at FROM updated`
+
+	err := r.db.QueryRow(ctx, query, message.RoomID, message.ID, message.Content).Scan(&message.EditedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrMessageNotFound
+	}
+	if err != nil {
+		return err
+	}
+	message.LinkPreviews = nil
+	return nil
+}
+
+// DeleteMessage мягко удаляет сообщение: строка остается в истории как надгробие,
+// а текст и вложения стираются. Файлы вложений удалит из хранилища фоновая очистка.
+// Удаленный ответ перестает учитываться в счетчике ветки.
+func (r *pgxRoomRepository) DeleteMessage(ctx context.Context, message *domain.Message) error {
+	// Подзапрос к messages в thread видит снимок до удаления, поэтому сам ответ
+	// исключается из него явно.
+	query := `WITH deleted AS (
+	              UPDATE messages SET content = '', deleted_at = now()
+	              WHERE room_id = $1 AND id = $2 AND deleted_at IS NULL
+	              RETURNING id, parent_id, deleted_at
+	          ), unlinked AS (
+	              DELETE FROM message_link_previews WHERE message_id IN (SELECT id FROM deleted)
+	          ), files AS (
+	              DELETE FROM attachments WHERE message_id IN (SELECT id FROM deleted)
+	          ), thread AS (
+	              UPDATE messages p
+	              SET reply_count = GREATEST(p.reply_count - 1, 0),
+	                  last_reply_at = (SELECT MAX(m.created_at) FROM messages m
+	                                   WHERE m.parent_id = p.id AND m.deleted_at IS NULL AND m.id <> d.id)
+	              FROM deleted d
+	              WHERE p.id = d.parent_id
+	          )
+	          SELECT deleted_at FROM deleted`
+
+	err := r.db.QueryRow(ctx, query, message.RoomID, message.ID).Scan(&message.DeletedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrMessageNotFound
+	}
+	if err != nil {
+		return err
+	}
+	message.Content = ""
+	message.Attachments = nil
+	message.LinkPreviews = nil
+	return nil
+}
+
+// attachDetails дополняет сообщения данными из связанных таблиц: реакциями,
+// вложениями и карточками ссылок.
+func (r *pgxRoomRepository) attachDetails(ctx context.Context, messages []domain.Message) error {
+	if err := attachReactions(ctx, r.db, messages); err != nil {
+		return err
+	}
+	if err := attachAttachments(ctx, r.db, messages); err != nil {
+		return err
+	}
+	return attachLinkPreviews(ctx, r.db, messages)
+}
+
+// GetMessagesByRoomID возвращает страницу сообщений комнаты (или ветки, см. MessageQuery)
+// в порядке возрастания ID. Без Forward возвращаются самые новые сообщения, предшествующие
+// BeforeID (если он задан), с Forward - самые старые сообщения после AfterID.
+func (r *pgxRoomRepository) GetMessagesByRoomID(ctx context.Context, roomID int64, q MessageQuery) ([]domain.Message, error) {
+	order := "DESC"
+	if q.Forward {
+		order = "ASC"
+	}
+
+	query := `SELECT ` + messageColumns + `
+	          FROM messages m
+			  JOIN users u ON m.user_id = u.id
+			  WHERE m.room_id = $1
+			    AND ($2::bigint = 0 OR m.id < $2)
+			    AND ($3::bigint = 0 OR m.id > $3)
+			    AND ($5::boolean OR m.parent_id IS NOT DISTINCT FROM NULLIF($6::bigint, 0))
+			  ORDER BY m.id ` + order + `
+			  LIMIT $4`
+	rows, err := r.db.Query(ctx, query, roomID, q.BeforeID, q.AfterID, q.Limit, q.WithReplies, q.ParentID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var messages []domain.Message
+	messages := []domain.Message{}
 	for rows.Next() {
 		var msg domain.Message
-		if err := rows.Scan(&msg.ID, &msg.RoomID, &msg.UserID, &msg.Username, &msg.Content, &msg.CreatedAt); err != nil {
+		if err := scanMessage(rows, &msg); err != nil {
 			return nil, err
 		}
 		messages = append(messages, msg)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if order == "DESC" {
+		slices.Reverse(messages)
+	}
+
+	if err := r.attachDetails(ctx, messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// Маркеры начала и конца совпадения в ts_headline. Символы из области частного
+// использования Unicode не встречаются в обычном тексте, поэтому после экранирования
+// фрагмента их можно безопасно заменить на теги <mark>.
+const (
+	headlineStart = "\uE000"
+	headlineStop  = "\uE001"
+)
 
-	return messages, rows.Err()
-}
\ No newline at end of file
+var headlineOptions = "StartSel=" + headlineStart + ", StopSel=" + headlineStop +
+	`, MaxWords=20, MinWords=5, MaxFragments=2, FragmentDelimiter=" … "`
+
+// SearchMessages ищет сообщения по тексту и возвращает их в порядке убывания релевантности.
+// Без RoomID поиск идет по публичным комнатам и комнатам, в которых состоит пользователь.
+func (r *pgxRoomRepository) SearchMessages(ctx context.Context, userID int64, q SearchQuery) ([]domain.SearchResult, error) {
+	query := `SELECT ` + messageColumns + `, r.name,
+	                 ts_headline('simple', m.content, tq, $5), ts_rank(m.search_vector, tq)
+	          FROM messages m
+			  JOIN users u ON m.user_id = u.id
+			  JOIN rooms r ON m.room_id = r.id,
+			  websearch_to_tsquery('simple', $2) tq
+			  WHERE m.search_vector @@ tq
+			    AND m.deleted_at IS NULL
+			    AND ($3::bigint = 0 OR m.room_id = $3)
+			    AND ((r.visibility = 'public' AND r.kind = 'room')
+			         OR EXISTS (SELECT 1 FROM room_members rm WHERE rm.room_id = r.id AND rm.user_id = $1))
+			    AND NOT EXISTS (SELECT 1 FROM room_bans b WHERE b.room_id = r.id AND b.user_id = $1)
+			  ORDER BY ts_rank(m.search_vector, tq) DESC, m.id DESC
+			  LIMIT $4 OFFSET $6`
+	rows, err := r.db.Query(ctx, query, userID, q.Text, q.RoomID, q.Limit, headlineOptions, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []domain.SearchResult{}
+	for rows.Next() {
+		var res domain.SearchResult
+		if err := scanMessage(rows, &res.Message, &res.RoomName, &res.Snippet, &res.Rank); err != nil {
+			return nil, err
+		}
+		res.Snippet = highlightSnippet(res.Snippet)
+		results = append(results, res)
+	}
+
+	return results, rows.Err()
+}
+
+// highlightSnippet экранирует фрагмент ts_headline и заменяет маркеры совпадений на <mark>.
+func highlightSnippet(headline string) string {
+	escaped := html.EscapeString(headline)
+	return strings.NewReplacer(headlineStart, "<mark>", headlineStop, "</mark>").Replace(escaped)
+}
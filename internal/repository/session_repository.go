@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-chat/internal/domain"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrRefreshTokenInvalid - токен неизвестен, истек или его сессия отозвана.
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid")
+	// ErrRefreshTokenReused - токен уже был обменян на новый. Сессия при этом отзывается.
+	ErrRefreshTokenReused = errors.New("refresh token has already been used")
+)
+
+// Не чаще этого обновляется last_used_at сессии, чтобы не писать в БД на каждый запрос.
+const sessionTouchInterval = time.Minute
+
+// SessionRepository определяет интерфейс для работы с сессиями и refresh-токенами.
+type SessionRepository interface {
+	Create(ctx context.Context, session *domain.Session, refreshHash []byte, refreshExpiresAt time.Time) error
+	Touch(ctx context.Context, sessionID int64) (bool, error)
+	GetActiveByUser(ctx context.Context, userID int64) ([]domain.Session, error)
+	Revoke(ctx context.Context, userID, sessionID int64) error
+	RevokeOthers(ctx context.Context, userID, keepSessionID int64) ([]int64, error)
+	RotateRefreshToken(ctx context.Context, oldHash, newHash []byte, newExpiresAt time.Time, userAgent, ip string) (*domain.Session, error)
+}
+
+type pgxSessionRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewSessionRepository(db *pgxpool.Pool) SessionRepository {
+	return &pgxSessionRepository{db: db}
+}
+
+// Create создает сессию и ее первый refresh-токен.
+func (r *pgxSessionRepository) Create(ctx context.Context, session *domain.Session, refreshHash []byte, refreshExpiresAt time.Time) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `INSERT INTO sessions (user_id, user_agent, ip) VALUES ($1, $2, $3) RETURNING id, created_at, last_used_at`
+	err = tx.QueryRow(ctx, query, session.UserID, session.UserAgent, session.IP).Scan(&session.ID, &session.CreatedAt, &session.LastUsedAt)
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO refresh_tokens (session_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+	if _, err := tx.Exec(ctx, query, session.ID, refreshHash, refreshExpiresAt); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Touch сообщает, существует ли сессия и не отозвана ли она, и отмечает ее использование.
+func (r *pgxSessionRepository) Touch(ctx context.Context, sessionID int64) (bool, error) {
+	query := `WITH active AS (
+	              SELECT id, last_used_at FROM sessions WHERE id = $1 AND revoked_at IS NULL
+	          ), touched AS (
+	              UPDATE sessions SET last_used_at = now()
+	              WHERE id IN (SELECT id FROM active WHERE last_used_at < $2)
+	          )
+	          SELECT EXISTS (SELECT 1 FROM active)`
+
+	var active bool
+	err := r.db.QueryRow(ctx, query, sessionID, time.Now().Add(-sessionTouchInterval)).Scan(&active)
+	return active, err
+}
+
+// GetActiveByUser возвращает неотозванные сессии пользователя, начиная с недавно использованных.
+func (r *pgxSessionRepository) GetActiveByUser(ctx context.Context, userID int64) ([]domain.Session, error) {
+	query := `SELECT id, user_id, user_agent, ip, created_at, last_used_at
+	          FROM sessions
+			  WHERE user_id = $1 AND revoked_at IS NULL
+			  ORDER BY last_used_at DESC`
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []domain.Session{}
+	for rows.Next() {
+		var s domain.Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastUsedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	return sessions, rows.Err()
+}
+
+// Revoke отзывает сессию пользователя. Отзыв уже отозванной сессии не считается ошибкой.
+func (r *pgxSessionRepository) Revoke(ctx context.Context, userID, sessionID int64) error {
+	query := `UPDATE sessions SET revoked_at = COALESCE(revoked_at, now()) WHERE id = $1 AND user_id = $2`
+
+	tag, err := r.db.Exec(ctx, query, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeOthers отзывает все сессии пользователя, кроме keepSessionID, и возвращает их ID.
+func (r *pgxSessionRepository) RevokeOthers(ctx context.Context, userID, keepSessionID int64) ([]int64, error) {
+	query := `UPDATE sessions SET revoked_at = now()
+	          WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL
+			  RETURNING id`
+	rows, err := r.db.Query(ctx, query, userID, keepSessionID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int64])
+}
+
+// RotateRefreshToken обменивает refresh-токен на новый в той же сессии и запоминает,
+// с какого устройства это сделано. Если токен уже был обменян, кто-то пользуется его
+// копией: сессия отзывается целиком, а метод возвращает ее вместе с ErrRefreshTokenReused.
+func (r *pgxSessionRepository) RotateRefreshToken(ctx context.Context, oldHash, newHash []byte, newExpiresAt time.Time, userAgent, ip string) (*domain.Session, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `SELECT rt.id, rt.expires_at, rt.used_at, s.id, s.user_id, s.created_at, s.revoked_at
+	          FROM refresh_tokens rt
+			  JOIN sessions s ON s.id = rt.session_id
+			  WHERE rt.token_hash = $1
+			  FOR UPDATE`
+
+	var (
+		tokenID   int64
+		expiresAt time.Time
+		usedAt    *time.Time
+		session   domain.Session
+	)
+	err = tx.QueryRow(ctx, query, oldHash).Scan(&tokenID, &expiresAt, &usedAt,
+		&session.ID, &session.UserID, &session.CreatedAt, &session.RevokedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if session.IsRevoked() {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if usedAt != nil {
+		if _, err := tx.Exec(ctx, `UPDATE sessions SET revoked_at = now() WHERE id = $1`, session.ID); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, err
+		}
+		return &session, ErrRefreshTokenReused
+	}
+	if time.Now().After(expiresAt) {
+		return nil, ErrRefreshTokenInvalid
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE refresh_tokens SET used_at = now() WHERE id = $1`, tokenID); err != nil {
+		return nil, err
+	}
+	query = `UPDATE sessions SET user_agent = $2, ip = $3, last_used_at = now() WHERE id = $1
+	         RETURNING user_agent, ip, last_used_at`
+	if err := tx.QueryRow(ctx, query, session.ID, userAgent, ip).Scan(&session.UserAgent, &session.IP, &session.LastUsedAt); err != nil {
+		return nil, err
+	}
+	query = `INSERT INTO refresh_tokens (session_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+	if _, err := tx.Exec(ctx, query, session.ID, newHash, newExpiresAt); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-chat/internal/domain"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrTwoFactorNotFound = errors.New("two-factor authentication is not enrolled")
+	// ErrTwoFactorEnabled означает, что второй фактор уже подключен и подтвержден.
+	ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrMFAChallengeInvalid означает, что вход не найден, истек, уже завершен
+	// или исчерпал попытки ввода кода.
+	ErrMFAChallengeInvalid = errors.New("mfa challenge is invalid or expired")
+)
+
+// TwoFactorRepository хранит TOTP-секреты, коды восстановления и входы, ожидающие второго фактора.
+type TwoFactorRepository interface {
+	Get(ctx context.Context, userID int64) (*domain.TwoFactor, error)
+	// SavePending сохраняет новый секрет неподтвержденного подключения.
+	SavePending(ctx context.Context, userID int64, secret []byte) error
+	// Confirm завершает подключение и заменяет коды восстановления.
+	Confirm(ctx context.Context, userID, step int64, recoveryHashes [][]byte) error
+	// UseStep принимает код с шагом step, если он новее последнего принятого.
+	UseStep(ctx context.Context, userID, step int64) (bool, error)
+	// UseRecoveryCode погашает код восстановления.
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash []byte) (bool, error)
+	Delete(ctx context.Context, userID int64) error
+
+	CreateChallenge(ctx context.Context, userID int64, tokenHash []byte, expiresAt time.Time) error
+	// AttemptChallenge засчитывает попытку ввода кода и возвращает пользователя,
+	// который входит. Попытки сверх maxAttempts не принимаются.
+	AttemptChallenge(ctx context.Context, tokenHash []byte, maxAttempts int) (int64, error)
+	// CompleteChallenge завершает вход. Каждый вход можно завершить только один раз.
+	CompleteChallenge(ctx context.Context, tokenHash []byte) error
+}
+
+type pgxTwoFactorRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewTwoFactorRepository(db *pgxpool.Pool) TwoFactorRepository {
+	return &pgxTwoFactorRepository{db: db}
+}
+
+func (r *pgxTwoFactorRepository) Get(ctx context.Context, userID int64) (*domain.TwoFactor, error) {
+	query := `SELECT user_id, secret, last_used_step, created_at, confirmed_at FROM user_totp WHERE user_id = $1`
+
+	tf := new(domain.TwoFactor)
+	err := r.db.QueryRow(ctx, query, userID).Scan(&tf.UserID, &tf.Secret, &tf.LastUsedStep, &tf.CreatedAt, &tf.ConfirmedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrTwoFactorNotFound
+		}
+		return nil, err
+	}
+	return tf, nil
+}
+
+func (r *pgxTwoFactorRepository) SavePending(ctx context.Context, userID int64, secret []byte) error {
+	query := `INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+	          ON CONFLICT (user_id) DO UPDATE
+			  SET secret = EXCLUDED.secret, last_used_step = 0, created_at = now()
+			  WHERE user_totp.confirmed_at IS NULL`
+
+	tag, err := r.db.Exec(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTwoFactorEnabled
+	}
+	return nil
+}
+
+func (r *pgxTwoFactorRepository) Confirm(ctx context.Context, userID, step int64, recoveryHashes [][]byte) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE user_totp SET confirmed_at = now(), last_used_step = $2
+	          WHERE user_id = $1 AND confirmed_at IS NULL`
+	tag, err := tx.Exec(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTwoFactorEnabled
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	query = `INSERT INTO recovery_codes (user_id, code_hash) SELECT $1, unnest($2::bytea[])`
+	if _, err := tx.Exec(ctx, query, userID, recoveryHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *pgxTwoFactorRepository) UseStep(ctx context.Context, userID, step int64) (bool, error) {
+	query := `UPDATE user_totp SET last_used_step = $2
+	          WHERE user_id = $1 AND confirmed_at IS NOT NULL AND last_used_step < $2`
+
+	tag, err := r.db.Exec(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *pgxTwoFactorRepository) UseRecoveryCode(ctx context.Context, userID int64, codeHash []byte) (bool, error) {
+	query := `UPDATE recovery_codes SET used_at = now()
+	          WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+
+	tag, err := r.db.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *pgxTwoFactorRepository) Delete(ctx context.Context, userID int64) error {
+	query := `WITH deleted_codes AS (
+	              DELETE FROM recovery_codes WHERE user_id = $1
+	          )
+	          DELETE FROM user_totp WHERE user_id = $1`
+
+	tag, err := r.db.Exec(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTwoFactorNotFound
+	}
+	return nil
+}
+
+func (r *pgxTwoFactorRepository) CreateChallenge(ctx context.Context, userID int64, tokenHash []byte, expiresAt time.Time) error {
+	query := `INSERT INTO mfa_challenges (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+
+	_, err := r.db.Exec(ctx, query, userID, tokenHash, expiresAt)
+	return err
+}
+
+func (r *pgxTwoFactorRepository) AttemptChallenge(ctx context.Context, tokenHash []byte, maxAttempts int) (int64, error) {
+	query := `UPDATE mfa_challenges SET attempts = attempts + 1
+	          WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now() AND attempts < $2
+			  RETURNING user_id`
+
+	var userID int64
+	if err := r.db.QueryRow(ctx, query, tokenHash, maxAttempts).Scan(&userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrMFAChallengeInvalid
+		}
+		return 0, err
+	}
+	return userID, nil
+}
+
+func (r *pgxTwoFactorRepository) CompleteChallenge(ctx context.Context, tokenHash []byte) error {
+	query := `UPDATE mfa_challenges SET used_at = now()
+	          WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()`
+
+	tag, err := r.db.Exec(ctx, query, tokenHash)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMFAChallengeInvalid
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"go-chat/internal/domain"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -12,6 +13,9 @@ import (
 type UserRepository interface {
 	Create(ctx context.Context, user *domain.User) error
 	GetByEmail(ctx context.Context, email string) (*domain.User, error)
+	GetByID(ctx context.Context, id int64) (*domain.User, error)
+	GetLastSeen(ctx context.Context, id int64) (*time.Time, error)
+	UpdateLastSeen(ctx context.Context, id int64, at time.Time) error
 }
 
 type pgxUserRepository struct {
@@ -36,7 +40,7 @@ func (r *pgxUserRepository) Create(ctx context.Context, user *domain.User) error
 }
 
 func (r *pgxUserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
-	query := `SELECT id, username, email, password_hash, created_at FROM users WHERE email = $1`
+	query := `SELECT id, username, email, password_hash, created_at, email_verified_at FROM users WHERE email = $1`
 
 	user := new(domain.User)
 
@@ -46,14 +50,61 @@ func (r *pgxUserRepository) GetByEmail(ctx context.Context, email string) (*doma
 		&user.Email,
 		&user.PasswordHash,
 		&user.CreatedAt,
+		&user.EmailVerifiedAt,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrUserNotFound
 		}
+		return nil, err
 	}
 
 	return user, nil
 }
 
+func (r *pgxUserRepository) GetByID(ctx context.Context, id int64) (*domain.User, error) {
+	query := `SELECT id, username, email, password_hash, created_at, email_verified_at FROM users WHERE id = $1`
+
+	user := new(domain.User)
+
+	err := r.db.QueryRow(ctx, query, id).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.PasswordHash,
+		&user.CreatedAt,
+		&user.EmailVerifiedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// GetLastSeen возвращает время, когда пользователь последний раз был в сети.
+// Пусто, если он ни разу не подключался.
+func (r *pgxUserRepository) GetLastSeen(ctx context.Context, id int64) (*time.Time, error) {
+	query := `SELECT last_seen_at FROM users WHERE id = $1`
+
+	var lastSeen *time.Time
+	if err := r.db.QueryRow(ctx, query, id).Scan(&lastSeen); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return lastSeen, nil
+}
+
+func (r *pgxUserRepository) UpdateLastSeen(ctx context.Context, id int64, at time.Time) error {
+	query := `UPDATE users SET last_seen_at = GREATEST(last_seen_at, $2) WHERE id = $1`
+
+	_, err := r.db.Exec(ctx, query, id, at)
+	return err
+}
+
 var ErrUserNotFound = errors.New("user not found")
\ No newline at end of file
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-chat/internal/domain"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrUserTokenInvalid означает, что токен из письма не найден, истек или уже использован.
+var ErrUserTokenInvalid = errors.New("user token is invalid or expired")
+
+// UserTokenRepository хранит одноразовые токены подтверждения почты и сброса пароля.
+type UserTokenRepository interface {
+	// Create сохраняет новый токен. Ранее выданные токены того же назначения
+	// перестают действовать: работает только ссылка из последнего письма.
+	Create(ctx context.Context, userID int64, purpose domain.TokenPurpose, tokenHash []byte, expiresAt time.Time) error
+	// VerifyEmail погашает токен подтверждения и отмечает адрес пользователя подтвержденным.
+	VerifyEmail(ctx context.Context, tokenHash []byte) (int64, error)
+	// ResetPassword погашает токен сброса, меняет пароль и отзывает все сессии пользователя.
+	// Возвращает ID пользователя и ID отозванных сессий.
+	ResetPassword(ctx context.Context, tokenHash []byte, passwordHash string) (int64, []int64, error)
+}
+
+type pgxUserTokenRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewUserTokenRepository(db *pgxpool.Pool) UserTokenRepository {
+	return &pgxUserTokenRepository{db: db}
+}
+
+func (r *pgxUserTokenRepository) Create(ctx context.Context, userID int64, purpose domain.TokenPurpose, tokenHash []byte, expiresAt time.Time) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE user_tokens SET used_at = now()
+	          WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`
+	if _, err := tx.Exec(ctx, query, userID, purpose); err != nil {
+		return err
+	}
+
+	query = `INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at) VALUES ($1, $2, $3, $4)`
+	if _, err := tx.Exec(ctx, query, userID, purpose, tokenHash, expiresAt); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *pgxUserTokenRepository) VerifyEmail(ctx context.Context, tokenHash []byte) (int64, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	userID, err := consumeUserToken(ctx, tx, domain.TokenPurposeEmailVerification, tokenHash)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `UPDATE users SET email_verified_at = COALESCE(email_verified_at, now()) WHERE id = $1`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit(ctx)
+}
+
+func (r *pgxUserTokenRepository) ResetPassword(ctx context.Context, tokenHash []byte, passwordHash string) (int64, []int64, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	userID, err := consumeUserToken(ctx, tx, domain.TokenPurposePasswordReset, tokenHash)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Письмо пришло на адрес пользователя, значит, адрес заодно подтвержден.
+	query := `UPDATE users SET password_hash = $2, email_verified_at = COALESCE(email_verified_at, now())
+	          WHERE id = $1`
+	if _, err := tx.Exec(ctx, query, userID, passwordHash); err != nil {
+		return 0, nil, err
+	}
+
+	query = `UPDATE sessions SET revoked_at = now()
+	         WHERE user_id = $1 AND revoked_at IS NULL
+			 RETURNING id`
+	rows, err := tx.Query(ctx, query, userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	revoked, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return userID, revoked, tx.Commit(ctx)
+}
+
+// consumeUserToken отмечает токен использованным и возвращает ID его владельца.
+func consumeUserToken(ctx context.Context, tx pgx.Tx, purpose domain.TokenPurpose, tokenHash []byte) (int64, error) {
+	query := `UPDATE user_tokens SET used_at = now()
+	          WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > now()
+			  RETURNING user_id`
+
+	var userID int64
+	if err := tx.QueryRow(ctx, query, tokenHash, purpose).Scan(&userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrUserTokenInvalid
+		}
+		return 0, err
+	}
+	return userID, nil
+}
@@ -0,0 +1,18 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// Storage хранит содержимое файлов по ключу. Метаданные файлов хранятся в БД отдельно.
+type Storage interface {
+	// Put сохраняет size байт из r под ключом key.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get открывает объект для чтения. Если объекта нет, возвращает ErrNotFound.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
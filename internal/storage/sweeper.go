@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	// Сколько файлов удаляется за один проход.
+	sweepBatchSize = 100
+	// Максимальное время одного прохода.
+	sweepTimeout = 5 * time.Minute
+)
+
+// OrphanStore - метаданные вложений, которые нужны для очистки хранилища.
+type OrphanStore interface {
+	DeleteUnlinked(ctx context.Context, before time.Time) (int64, error)
+	OrphanedFiles(ctx context.Context, limit int) ([]string, error)
+	ForgetOrphanedFile(ctx context.Context, key string) error
+}
+
+// Sweeper периодически удаляет из хранилища файлы, на которые больше не ссылается
+// ни одно вложение, и загрузки, которые так и не прикрепили к сообщению.
+type Sweeper struct {
+	storage     Storage
+	store       OrphanStore
+	unlinkedTTL time.Duration
+	interval    time.Duration
+}
+
+// NewSweeper создает очистку, которая раз в interval удаляет неприкрепленные
+// загрузки старше unlinkedTTL и файлы удаленных вложений.
+func NewSweeper(storage Storage, store OrphanStore, unlinkedTTL, interval time.Duration) *Sweeper {
+	return &Sweeper{storage: storage, store: store, unlinkedTTL: unlinkedTTL, interval: interval}
+}
+
+// Run выполняет очистку сразу и затем раз в interval, пока не будет отменен ctx.
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Sweep(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("storage sweeper: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep выполняет один проход очистки. Файл, который не удалось удалить,
+// остается в очереди до следующего прохода.
+func (s *Sweeper) Sweep(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, sweepTimeout)
+	defer cancel()
+
+	if n, err := s.store.DeleteUnlinked(ctx, time.Now().Add(-s.unlinkedTTL)); err != nil {
+		return err
+	} else if n > 0 {
+		log.Printf("storage sweeper: удалено неприкрепленных вложений: %d", n)
+	}
+
+	for {
+		keys, err := s.store.OrphanedFiles(ctx, sweepBatchSize)
+		if err != nil {
+			return err
+		}
+
+		removed := 0
+		for _, key := range keys {
+			if err := s.storage.Delete(ctx, key); err != nil {
+				log.Printf("storage sweeper: не удалось удалить %s: %v", key, err)
+				continue
+			}
+			if err := s.store.ForgetOrphanedFile(ctx, key); err != nil {
+				return err
+			}
+			removed++
+		}
+
+		// Если в пачке остались неудаляемые файлы, повторим их в следующий раз,
+		// а не будем выбирать их снова в этом проходе.
+		if len(keys) < sweepBatchSize || removed < len(keys) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeOrphanStore хранит очередь orphaned_files в памяти.
+type fakeOrphanStore struct {
+	orphans  []string
+	unlinked time.Time
+}
+
+func (f *fakeOrphanStore) DeleteUnlinked(ctx context.Context, before time.Time) (int64, error) {
+	f.unlinked = before
+	return 0, nil
+}
+
+func (f *fakeOrphanStore) OrphanedFiles(ctx context.Context, limit int) ([]string, error) {
+	return slices.Clone(f.orphans[:min(limit, len(f.orphans))]), nil
+}
+
+func (f *fakeOrphanStore) ForgetOrphanedFile(ctx context.Context, key string) error {
+	for i, k := range f.orphans {
+		if k == key {
+			f.orphans = append(f.orphans[:i], f.orphans[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("unknown key")
+}
+
+// failingStorage не может удалить ключи с префиксом "stuck/".
+type failingStorage struct {
+	*LocalStorage
+}
+
+func (s failingStorage) Delete(ctx context.Context, key string) error {
+	if strings.HasPrefix(key, "stuck/") {
+		return errors.New("storage unavailable")
+	}
+	return s.LocalStorage.Delete(ctx, key)
+}
+
+func TestSweeperRemovesOrphanedFiles(t *testing.T) {
+	local, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, key := range []string{"a", "b", "kept"} {
+		if err := local.Put(ctx, key, strings.NewReader(key), int64(len(key)), "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := &fakeOrphanStore{orphans: []string{"a", "b", "stuck/c", "missing"}}
+	sweeper := NewSweeper(failingStorage{local}, store, time.Hour, time.Hour)
+	if err := sweeper.Sweep(ctx); err != nil {
+		t.Fatalf("Sweep: %v", err)
+	}
+
+	for _, key := range []string{"a", "b"} {
+		if _, err := os.Stat(filepath.Join(local.root, key)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("file %q was not removed", key)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(local.root, "kept")); err != nil {
+		t.Errorf("file that is still referenced was removed: %v", err)
+	}
+	if len(store.orphans) != 1 || store.orphans[0] != "stuck/c" {
+		t.Errorf("queue after sweep = %v, want only the file that failed to delete", store.orphans)
+	}
+	if age := time.Since(store.unlinked); age < time.Hour || age > time.Hour+time.Minute {
+		t.Errorf("unlinked cutoff is %s ago, want about an hour", age)
+	}
+}
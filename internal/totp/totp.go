@@ -0,0 +1,95 @@
+// Package totp реализует одноразовые пароли по времени (RFC 6238) в варианте,
+// который понимают распространенные приложения-аутентификаторы: HMAC-SHA1,
+// 6 цифр, шаг 30 секунд.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	// Period - шаг времени в секундах.
+	Period = 30
+	// Digits - длина кода.
+	Digits = 6
+	// Размер секрета в байтах, рекомендованный RFC 4226 для HMAC-SHA1.
+	secretSize = 20
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret создает случайный секрет.
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// EncodeSecret возвращает секрет в base32 - в таком виде его вводят в приложение вручную.
+func EncodeSecret(secret []byte) string {
+	return encoding.EncodeToString(secret)
+}
+
+// ProvisioningURI возвращает otpauth://-ссылку для QR-кода.
+func ProvisioningURI(issuer, account string, secret []byte) string {
+	params := url.Values{}
+	params.Set("secret", EncodeSecret(secret))
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(Digits))
+	params.Set("period", fmt.Sprint(Period))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: params.Encode(),
+	}
+	return u.String()
+}
+
+// Step возвращает номер шага времени для момента t.
+func Step(t time.Time) int64 {
+	return t.Unix() / Period
+}
+
+// Code вычисляет код для шага времени.
+func Code(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Динамическое усечение (RFC 4226, раздел 5.3).
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, value%1_000_000)
+}
+
+// Validate проверяет код для момента t, допуская расхождение часов на skew шагов
+// в каждую сторону. Возвращает шаг, которому соответствует код: чтобы код нельзя было
+// использовать повторно, вызывающий должен принимать только шаги больше последнего.
+func Validate(secret []byte, code string, t time.Time, skew int64) (int64, bool) {
+	if len(code) != Digits {
+		return 0, false
+	}
+	current := Step(t)
+	for step := current - skew; step <= current+skew; step++ {
+		if subtle.ConstantTimeCompare([]byte(Code(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,83 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Секрет из приложения B RFC 6238 для HMAC-SHA1.
+var rfcSecret = []byte("12345678901234567890")
+
+// Векторы из приложения B RFC 6238. Коды в RFC восьмизначные; шестизначный код -
+// те же цифры по модулю 10^6, то есть последние шесть.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "94287082"},
+	{1111111109, "07081804"},
+	{1111111111, "14050471"},
+	{1234567890, "89005924"},
+	{2000000000, "69279037"},
+	{20000000000, "65353130"},
+}
+
+func TestCodeRFC6238Vectors(t *testing.T) {
+	for _, v := range rfcVectors {
+		step := Step(time.Unix(v.unix, 0))
+		want := v.code[len(v.code)-Digits:]
+		if got := Code(rfcSecret, step); got != want {
+			t.Errorf("Code(T=%d) = %s, want %s", v.unix, got, want)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	for offset := int64(-2); offset <= 2; offset++ {
+		code := Code(rfcSecret, current+offset)
+		step, ok := Validate(rfcSecret, code, now, 1)
+		wantOK := offset >= -1 && offset <= 1
+		if ok != wantOK {
+			t.Errorf("offset %d: ok = %v, want %v", offset, ok, wantOK)
+		}
+		if ok && step != current+offset {
+			t.Errorf("offset %d: step = %d, want %d", offset, step, current+offset)
+		}
+	}
+
+	if _, ok := Validate(rfcSecret, Code(rfcSecret, current+1), now, 0); ok {
+		t.Error("code from the next step accepted without skew")
+	}
+}
+
+func TestValidateRejectsMalformedCodes(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870820", "94287082", "abcdef"} {
+		if _, ok := Validate(rfcSecret, code, now, 1); ok {
+			t.Errorf("Validate(%q) accepted", code)
+		}
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("go-chat", "alice@example.com", rfcSecret)
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/go-chat:alice@example.com" {
+		t.Errorf("unexpected URI %s", uri)
+	}
+	q := u.Query()
+	if q.Get("secret") != EncodeSecret(rfcSecret) || strings.Contains(q.Get("secret"), "=") {
+		t.Errorf("secret = %q, want unpadded base32", q.Get("secret"))
+	}
+	if q.Get("digits") != "6" || q.Get("period") != "30" || q.Get("algorithm") != "SHA1" {
+		t.Errorf("unexpected parameters %v", q)
+	}
+}
@@ -0,0 +1,128 @@
+package unfurl
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress возвращается при попытке обратиться к адресу из закрытых диапазонов.
+var ErrForbiddenAddress = errors.New("unfurl: forbidden address")
+
+// Максимальное число переходов по редиректам.
+const maxRedirects = 5
+
+// Диапазоны, которые не покрываются методами netip.Addr, но тоже не должны быть доступны извне.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "этот" хост
+	netip.MustParsePrefix("100.64.0.0/10"),  // CGNAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // тестирование производительности
+	netip.MustParsePrefix("240.0.0.0/4"),    // зарезервировано, включая broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, ведет на IPv4
+	netip.MustParsePrefix("64:ff9b:1::/48"), // локальный NAT64
+	netip.MustParsePrefix("2002::/16"),      // 6to4, ведет на IPv4
+}
+
+// ClientConfig - настройки HTTP-клиента для получения страниц.
+type ClientConfig struct {
+	// Timeout ограничивает весь запрос, включая чтение тела и редиректы.
+	Timeout time.Duration
+	// AllowedNetworks - приватные адреса и подсети, к которым все же разрешено обращаться.
+	AllowedNetworks []netip.Prefix
+}
+
+// ParseNetworks разбирает список адресов и подсетей в нотации CIDR.
+func ParseNetworks(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %w", v, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", v, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// NewHTTPClient создает клиент с защитой от SSRF. Адрес проверяется в момент установки
+// соединения, уже после разрешения имени, поэтому подмена DNS-ответа между проверкой
+// и запросом не поможет. Так же проверяется каждый редирект.
+func NewHTTPClient(cfg ClientConfig) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: cfg.Timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !isAllowed(addrPort.Addr(), cfg.AllowedNetworks) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, addrPort.Addr())
+			}
+			return nil
+		},
+	}
+
+	transport := &http.Transport{
+		// Прокси из окружения не используется: иначе проверялся бы адрес прокси, а не цели.
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   cfg.Timeout,
+		ResponseHeaderTimeout: cfg.Timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   cfg.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("unfurl: too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("unfurl: unsupported redirect scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// isAllowed сообщает, можно ли обращаться к адресу.
+func isAllowed(addr netip.Addr, allowed []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,187 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-chat/internal/domain"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ErrNotHTML возвращается, если по ссылке находится не HTML-страница.
+var ErrNotHTML = errors.New("unfurl: not an html page")
+
+const (
+	userAgent = "go-chat-unfurl/1.0"
+	// Ограничения длины извлекаемых полей в символах.
+	maxTitleLength       = 300
+	maxDescriptionLength = 1000
+	maxURLLength         = 2048
+)
+
+// Fetcher загружает страницы и извлекает из них метаданные для карточек ссылок.
+type Fetcher struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+// NewFetcher создает Fetcher. Из ответа читается не больше maxBytes байт.
+func NewFetcher(client *http.Client, maxBytes int64) *Fetcher {
+	return &Fetcher{client: client, maxBytes: maxBytes}
+}
+
+// Fetch загружает страницу по ссылке и возвращает ее карточку. Карточка может оказаться
+// пустой (см. domain.LinkPreview.IsEmpty), если на странице нет подходящих метаданных.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*domain.LinkPreview, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unfurl: unsupported scheme %q", u.Scheme)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unfurl: unexpected status %d", resp.StatusCode)
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+		return nil, ErrNotHTML
+	}
+
+	// Итоговый адрес после редиректов нужен для разрешения относительных ссылок.
+	preview := parseHTML(io.LimitReader(resp.Body, f.maxBytes), resp.Request.URL)
+	preview.URL = rawURL
+	return preview, nil
+}
+
+// parseHTML извлекает метаданные из <head>. OpenGraph имеет приоритет над <title>
+// и <meta name="description">.
+func parseHTML(r io.Reader, base *url.URL) *domain.LinkPreview {
+	var title, description, ogTitle, ogDescription, ogImage, ogSiteName string
+
+	z := html.NewTokenizer(r)
+	inTitle := false
+loop:
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			// Конец документа, обрыв по лимиту размера или ошибка чтения:
+			// используем то, что успели прочитать.
+			break loop
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			switch token.DataAtom {
+			case atom.Title:
+				inTitle = true
+			case atom.Body:
+				break loop
+			case atom.Meta:
+				key, content := metaAttrs(token)
+				switch key {
+				case "og:title":
+					ogTitle = content
+				case "og:description":
+					ogDescription = content
+				case "og:image", "og:image:url":
+					if ogImage == "" {
+						ogImage = content
+					}
+				case "og:site_name":
+					ogSiteName = content
+				case "description":
+					description = content
+				}
+			}
+		case html.EndTagToken:
+			switch z.Token().DataAtom {
+			case atom.Title:
+				inTitle = false
+			case atom.Head:
+				break loop
+			}
+		case html.TextToken:
+			if inTitle && title == "" {
+				title = string(z.Text())
+			}
+		}
+	}
+
+	return &domain.LinkPreview{
+		Title:       clean(firstNonEmpty(ogTitle, title), maxTitleLength),
+		Description: clean(firstNonEmpty(ogDescription, description), maxDescriptionLength),
+		ImageURL:    resolveURL(base, ogImage),
+		SiteName:    clean(ogSiteName, maxTitleLength),
+	}
+}
+
+// metaAttrs возвращает имя (property или name) и содержимое тега <meta>.
+func metaAttrs(token html.Token) (string, string) {
+	var key, content string
+	for _, attr := range token.Attr {
+		switch attr.Key {
+		case "property", "name":
+			if key == "" {
+				key = strings.ToLower(strings.TrimSpace(attr.Val))
+			}
+		case "content":
+			content = attr.Val
+		}
+	}
+	return key, content
+}
+
+// resolveURL превращает ссылку на изображение в абсолютную. Ссылки не на http(s) отбрасываются.
+func resolveURL(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	if s := u.String(); len(s) <= maxURLLength {
+		return s
+	}
+	return ""
+}
+
+// clean схлопывает пробелы, исправляет невалидный UTF-8 и обрезает строку до limit символов.
+func clean(s string, limit int) string {
+	s = strings.Join(strings.Fields(strings.ToValidUTF8(s, "")), " ")
+	if utf8.RuneCountInString(s) > limit {
+		s = string([]rune(s)[:limit-1]) + "…"
+	}
+	return s
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
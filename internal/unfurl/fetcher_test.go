@@ -0,0 +1,206 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loopback разрешает обращаться к тестовому серверу на 127.0.0.1.
+var loopback = []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}
+
+func newTestFetcher(allowed []netip.Prefix, maxBytes int64) *Fetcher {
+	client := NewHTTPClient(ClientConfig{Timeout: 5 * time.Second, AllowedNetworks: allowed})
+	return NewFetcher(client, maxBytes)
+}
+
+// servePage отвечает на все запросы страницей body с типом contentType.
+func servePage(t *testing.T, contentType, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetchPrefersOpenGraph(t *testing.T) {
+	srv := servePage(t, "text/html; charset=utf-8", `<!doctype html><html><head>
+		<title>Plain title</title>
+		<meta name="description" content="Plain description">
+		<meta property="og:title" content="  OG   title ">
+		<meta property="og:description" content="OG description">
+		<meta property="og:site_name" content="Example">
+		</head><body><meta property="og:image" content="/ignored.png"></body></html>`)
+
+	preview, err := newTestFetcher(loopback, 1<<20).Fetch(context.Background(), srv.URL+"/post")
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if preview.Title != "OG title" {
+		t.Errorf("Title = %q, want OG title", preview.Title)
+	}
+	if preview.Description != "OG description" {
+		t.Errorf("Description = %q, want OG description", preview.Description)
+	}
+	if preview.SiteName != "Example" {
+		t.Errorf("SiteName = %q, want Example", preview.SiteName)
+	}
+	if preview.ImageURL != "" {
+		t.Errorf("ImageURL = %q, meta tags after <body> must be ignored", preview.ImageURL)
+	}
+	if preview.URL != srv.URL+"/post" {
+		t.Errorf("URL = %q, want the requested URL", preview.URL)
+	}
+}
+
+func TestFetchFallsBackToTitle(t *testing.T) {
+	srv := servePage(t, "text/html", `<html><head><title>Plain title</title>
+		<meta name="description" content="Plain description"></head></html>`)
+
+	preview, err := newTestFetcher(loopback, 1<<20).Fetch(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if preview.Title != "Plain title" || preview.Description != "Plain description" {
+		t.Errorf("got %q / %q, want the <title> and description fallbacks", preview.Title, preview.Description)
+	}
+}
+
+func TestFetchResolvesRelativeImage(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/articles/new", http.StatusFound)
+	})
+	mux.HandleFunc("/articles/new", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<head><meta property="og:title" content="T"><meta property="og:image" content="img/cover.png"></head>`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	preview, err := newTestFetcher(loopback, 1<<20).Fetch(context.Background(), srv.URL+"/old")
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	// Относительная ссылка разрешается от адреса после редиректа.
+	if want := srv.URL + "/articles/img/cover.png"; preview.ImageURL != want {
+		t.Errorf("ImageURL = %q, want %q", preview.ImageURL, want)
+	}
+}
+
+func TestFetchRejectsNonHTML(t *testing.T) {
+	srv := servePage(t, "application/json", `{"title": "not a page"}`)
+
+	_, err := newTestFetcher(loopback, 1<<20).Fetch(context.Background(), srv.URL)
+	if !errors.Is(err, ErrNotHTML) {
+		t.Errorf("err = %v, want ErrNotHTML", err)
+	}
+}
+
+func TestFetchStopsAtSizeLimit(t *testing.T) {
+	padding := strings.Repeat("<!-- padding -->", 1024)
+	srv := servePage(t, "text/html", `<head><title>Early</title>`+padding+
+		`<meta property="og:title" content="Too late"></head>`)
+
+	preview, err := newTestFetcher(loopback, 1024).Fetch(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if preview.Title != "Early" {
+		t.Errorf("Title = %q, metadata past the size limit must be ignored", preview.Title)
+	}
+}
+
+func TestFetchBlocksPrivateTargets(t *testing.T) {
+	srv := servePage(t, "text/html", `<head><title>Internal</title></head>`)
+
+	for _, target := range []string{srv.URL, "http://10.0.0.1/", "http://169.254.169.254/latest/meta-data/", "http://[::1]/"} {
+		_, err := newTestFetcher(nil, 1<<20).Fetch(context.Background(), target)
+		if !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("Fetch(%s): err = %v, want ErrForbiddenAddress", target, err)
+		}
+	}
+}
+
+func TestFetchBlocksRedirectIntoPrivateNetwork(t *testing.T) {
+	// Цель редиректа - другой loopback-адрес, который не входит в список разрешенных.
+	internal := listenOn(t, "127.0.0.2:0")
+	target := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<head><title>Internal</title></head>`))
+	}))
+	target.Listener = internal
+	target.Start()
+	defer target.Close()
+
+	public := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	}))
+	defer public.Close()
+
+	_, err := newTestFetcher(loopback, 1<<20).Fetch(context.Background(), public.URL)
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Fatalf("redirect into a private address: err = %v, want ErrForbiddenAddress", err)
+	}
+
+	// Явно разрешенную сеть можно получить и через редирект.
+	allowed := append([]netip.Prefix{netip.MustParsePrefix("127.0.0.2/32")}, loopback...)
+	preview, err := newTestFetcher(allowed, 1<<20).Fetch(context.Background(), public.URL)
+	if err != nil {
+		t.Fatalf("redirect into an allowed network: %v", err)
+	}
+	if preview.Title != "Internal" {
+		t.Errorf("Title = %q, want Internal", preview.Title)
+	}
+}
+
+func listenOn(t *testing.T, address string) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Skipf("cannot listen on %s: %v", address, err)
+	}
+	return l
+}
+
+func TestIsAllowed(t *testing.T) {
+	allowed, err := ParseNetworks([]string{"10.1.0.0/16", " 192.168.1.5 ", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"10.0.0.1", false},
+		{"10.1.2.3", true},
+		{"172.16.0.1", false},
+		{"192.168.1.5", true},
+		{"192.168.1.6", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"64:ff9b::7f00:1", false},
+	}
+	for _, tt := range tests {
+		if got := isAllowed(netip.MustParseAddr(tt.addr), allowed); got != tt.want {
+			t.Errorf("isAllowed(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package unfurl
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Максимальное число ссылок, для которых строятся карточки в одном сообщении.
+const maxURLsPerMessage = 3
+
+var urlPattern = regexp.MustCompile("https?://[^\\s<>\"'`]+")
+
+// ExtractURLs возвращает уникальные http(s)-ссылки из текста сообщения в порядке появления.
+func ExtractURLs(content string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, match := range urlPattern.FindAllString(content, -1) {
+		match = trimTrailing(match)
+		if len(match) > maxURLLength || seen[match] {
+			continue
+		}
+		u, err := url.Parse(match)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		seen[match] = true
+		urls = append(urls, match)
+		if len(urls) == maxURLsPerMessage {
+			break
+		}
+	}
+	return urls
+}
+
+// trimTrailing отрезает знаки препинания, которые в тексте стоят после ссылки.
+// Закрывающая скобка остается, если у нее есть пара внутри ссылки (как в Википедии).
+func trimTrailing(s string) string {
+	for len(s) > 0 {
+		last := s[len(s)-1]
+		switch {
+		case strings.IndexByte(".,;:!?'\"", last) >= 0:
+			s = s[:len(s)-1]
+		case last == ')' && strings.Count(s, "(") < strings.Count(s, ")"):
+			s = s[:len(s)-1]
+		case last == ']' && strings.Count(s, "[") < strings.Count(s, "]"):
+			s = s[:len(s)-1]
+		default:
+			return s
+		}
+	}
+	return s
+}
@@ -0,0 +1,151 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"go-chat/internal/domain"
+	"go-chat/internal/repository"
+	"go-chat/internal/websocket"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// Размер очереди сообщений, ожидающих обработки.
+	queueSize = 256
+	// Максимальное время обработки одного сообщения.
+	jobTimeout = 30 * time.Second
+)
+
+// job - сообщение, для ссылок которого нужно построить карточки.
+type job struct {
+	messageID int64
+	roomID    int64
+	content   string
+	urls      []string
+}
+
+// Worker в фоне строит карточки ссылок из новых сообщений, кэширует их
+// и рассылает в комнату событие message.updated.
+type Worker struct {
+	fetcher    *Fetcher
+	previews   repository.LinkPreviewRepository
+	roomRepo   repository.RoomRepository
+	hubManager *websocket.HubManager
+	cacheTTL   time.Duration
+	jobs       chan job
+}
+
+func NewWorker(fetcher *Fetcher, previews repository.LinkPreviewRepository, roomRepo repository.RoomRepository, hubManager *websocket.HubManager, cacheTTL time.Duration) *Worker {
+	return &Worker{
+		fetcher:    fetcher,
+		previews:   previews,
+		roomRepo:   roomRepo,
+		hubManager: hubManager,
+		cacheTTL:   cacheTTL,
+		jobs:       make(chan job, queueSize),
+	}
+}
+
+// Run запускает n обработчиков очереди и блокируется до отмены ctx.
+func (w *Worker) Run(ctx context.Context, n int) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case j := <-w.jobs:
+					w.process(ctx, j)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Enqueue ставит сообщение в очередь, если в нем есть ссылки. Не блокируется:
+// при переполненной очереди сообщение остается без карточек.
+// У nil-Worker (карточки отключены) ничего не делает.
+func (w *Worker) Enqueue(message *domain.Message) {
+	if w == nil || message.IsDeleted() {
+		return
+	}
+	urls := ExtractURLs(message.Content)
+	if len(urls) == 0 {
+		return
+	}
+
+	select {
+	case w.jobs <- job{messageID: message.ID, roomID: message.RoomID, content: message.Content, urls: urls}:
+	default:
+		log.Printf("link preview queue is full, skipping message %d", message.ID)
+	}
+}
+
+func (w *Worker) process(ctx context.Context, j job) {
+	ctx, cancel := context.WithTimeout(ctx, jobTimeout)
+	defer cancel()
+
+	var urls []string
+	for _, u := range j.urls {
+		preview, err := w.preview(ctx, u)
+		if err != nil {
+			log.Printf("failed to unfurl %s: %v", u, err)
+			continue
+		}
+		if !preview.IsEmpty() {
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) == 0 {
+		return
+	}
+
+	linked, err := w.previews.SetMessagePreviews(ctx, &domain.Message{ID: j.messageID, Content: j.content}, urls)
+	if err != nil {
+		log.Printf("failed to link previews to message %d: %v", j.messageID, err)
+		return
+	}
+	if !linked {
+		// Сообщение успели отредактировать или удалить.
+		return
+	}
+
+	message, err := w.roomRepo.GetMessage(ctx, j.roomID, j.messageID)
+	if err != nil {
+		log.Printf("failed to fetch message %d: %v", j.messageID, err)
+		return
+	}
+	if err := w.hubManager.Broadcast(ctx, j.roomID, domain.NewEvent(domain.EventMessageUpdated, message)); err != nil {
+		log.Printf("failed to broadcast %s to room %d: %v", domain.EventMessageUpdated, j.roomID, err)
+	}
+}
+
+// preview возвращает карточку из кэша, если она не старше cacheTTL, или загружает заново.
+// Пустые карточки тоже кэшируются, чтобы не запрашивать страницу без метаданных снова.
+func (w *Worker) preview(ctx context.Context, u string) (*domain.LinkPreview, error) {
+	cached, err := w.previews.Get(ctx, u)
+	if err == nil && time.Since(cached.FetchedAt) < w.cacheTTL {
+		return cached, nil
+	}
+	if err != nil && !errors.Is(err, repository.ErrLinkPreviewNotFound) {
+		return nil, err
+	}
+
+	preview, err := w.fetcher.Fetch(ctx, u)
+	if errors.Is(err, ErrNotHTML) {
+		preview, err = &domain.LinkPreview{URL: u}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := w.previews.Save(ctx, preview); err != nil {
+		return nil, err
+	}
+	return preview, nil
+}
@@ -0,0 +1,114 @@
+package validator
+
+import (
+	"unicode/utf8"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	zeroWidthJoiner    = '\u200D'
+	variationSelector  = '\uFE0F'
+	combiningKeycap    = '\u20E3'
+	blackFlag          = '\U0001F3F4'
+	cancelTag          = '\U000E007F'
+	regionalIndicatorA = '\U0001F1E6'
+	regionalIndicatorZ = '\U0001F1FF'
+)
+
+// validateEmoji - правило "emoji": строка состоит ровно из одного эмодзи.
+func validateEmoji(fl validator.FieldLevel) bool {
+	return isEmoji(fl.Field().String())
+}
+
+// isEmoji сообщает, является ли строка ровно одним эмодзи (одной графемой): одиночным
+// символом, флагом, кейкапом, тег-последовательностью или ZWJ-последовательностью,
+// в том числе с модификаторами цвета кожи. Проверка упрощает грамматику UTS #51
+// и не сверяется со списком существующих последовательностей.
+func isEmoji(s string) bool {
+	runes := []rune(s)
+	if len(runes) == 0 || !utf8.ValidString(s) {
+		return false
+	}
+
+	switch first := runes[0]; {
+	case isRegionalIndicator(first):
+		return len(runes) == 2 && isRegionalIndicator(runes[1])
+	case isKeycapBase(first):
+		rest := runes[1:]
+		if len(rest) > 0 && rest[0] == variationSelector {
+			rest = rest[1:]
+		}
+		return len(rest) == 1 && rest[0] == combiningKeycap
+	case first == blackFlag && len(runes) > 1 && isTag(runes[1]):
+		for i, r := range runes[1:] {
+			if r == cancelTag {
+				return i+2 == len(runes)
+			}
+			if !isTag(r) {
+				return false
+			}
+		}
+		return false
+	}
+
+	// ZWJ-последовательность из одного или нескольких элементов.
+	for i := 0; ; {
+		if i >= len(runes) || !isPictographic(runes[i]) {
+			return false
+		}
+		i++
+		if i < len(runes) && runes[i] == variationSelector {
+			i++
+		}
+		if i < len(runes) && isSkinToneModifier(runes[i]) {
+			i++
+		}
+		if i == len(runes) {
+			return true
+		}
+		if runes[i] != zeroWidthJoiner {
+			return false
+		}
+		i++
+	}
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= regionalIndicatorA && r <= regionalIndicatorZ
+}
+
+func isKeycapBase(r rune) bool {
+	return r >= '0' && r <= '9' || r == '#' || r == '*'
+}
+
+func isTag(r rune) bool {
+	return r >= '\U000E0020' && r <= '\U000E007E'
+}
+
+func isSkinToneModifier(r rune) bool {
+	return r >= '\U0001F3FB' && r <= '\U0001F3FF'
+}
+
+// isPictographic приближенно проверяет свойство Extended_Pictographic: блоки
+// символов и пиктограмм, из которых состоят эмодзи.
+func isPictographic(r rune) bool {
+	switch {
+	case isRegionalIndicator(r), isSkinToneModifier(r):
+		return false
+	case r >= '\U0001F000' && r <= '\U0001FAFF':
+		return true
+	case r >= '\u2600' && r <= '\u27BF':
+		return true
+	case r >= '\u2190' && r <= '\u21FF', r >= '\u2300' && r <= '\u23FF', r >= '\u25A0' && r <= '\u25FF':
+		return true
+	case r >= '\u2B00' && r <= '\u2BFF', r >= '\u2900' && r <= '\u297F':
+		return true
+	}
+	switch r {
+	case '\u00A9', '\u00AE', '\u203C', '\u2049', '\u2122', '\u2139', '\u24C2',
+		'\u3030', '\u303D', '\u3297', '\u3299':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package validator
+
+import "testing"
+
+func TestIsEmoji(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  bool
+	}{
+		{"single", "\U0001F44D", true},
+		{"text presentation", "\u2764", true},
+		{"variation selector", "\u2764\uFE0F", true},
+		{"skin tone", "\U0001F44D\U0001F3FD", true},
+		{"flag", "\U0001F1F7\U0001F1FA", true},
+		{"keycap", "1\uFE0F\u20E3", true},
+		{"tag sequence", "\U0001F3F4\U000E0067\U000E0062\U000E0065\U000E006E\U000E0067\U000E007F", true},
+		{"zwj family", "\U0001F468\u200D\U0001F469\u200D\U0001F467", true},
+		{"zwj with skin tones", "\U0001F9D1\U0001F3FB\u200D\u2764\uFE0F\u200D\U0001F48B\u200D\U0001F9D1\U0001F3FC", true},
+
+		{"empty", "", false},
+		{"text", "lol", false},
+		{"digit", "1", false},
+		{"two emoji", "\U0001F44D\U0001F44D", false},
+		{"emoji and text", "\U0001F44Dx", false},
+		{"single regional indicator", "\U0001F1F7", false},
+		{"three regional indicators", "\U0001F1F7\U0001F1FA\U0001F1F8", false},
+		{"lone skin tone", "\U0001F3FD", false},
+		{"trailing zwj", "\U0001F468\u200D", false},
+		{"unterminated tag sequence", "\U0001F3F4\U000E0067\U000E0062", false},
+		{"invalid utf8", "\xff", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isEmoji(tt.input); got != tt.want {
+				t.Errorf("isEmoji(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatorEmojiTag(t *testing.T) {
+	type request struct {
+		Emoji string `validate:"required,emoji"`
+	}
+
+	v := NewValidator()
+	if err := v.Validate(&request{Emoji: "\U0001F389"}); err != nil {
+		t.Errorf("valid emoji rejected: %v", err)
+	}
+	if err := v.Validate(&request{Emoji: "<script>"}); err == nil {
+		t.Error("text accepted as emoji")
+	}
+}
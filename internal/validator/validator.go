@@ -13,5 +13,7 @@ func (cv *CustomValidator) Validate(i interface{}) error {
 }
 
 func NewValidator() *CustomValidator {
-	return &CustomValidator{validator: validator.New()}
+	v := validator.New()
+	v.RegisterValidation("emoji", validateEmoji)
+	return &CustomValidator{validator: v}
 }
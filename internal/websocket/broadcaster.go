@@ -0,0 +1,31 @@
+package websocket
+
+import (
+	"context"
+
+	"go-chat/internal/domain"
+)
+
+// Broadcaster публикует события комнат. Реализация отвечает за то, чтобы событие
+// попало в HubManager.Deliver на каждом экземпляре сервиса, где есть хаб этой комнаты.
+// События пользователя так же должны попасть в HubManager.DeliverToUser.
+type Broadcaster interface {
+	Publish(ctx context.Context, roomID int64, event *domain.Event) error
+	PublishToUser(ctx context.Context, userID int64, event *domain.Event) error
+}
+
+// localBroadcaster доставляет события только в хабы текущего процесса.
+// Используется по умолчанию, когда сервис запущен в единственном экземпляре.
+type localBroadcaster struct {
+	manager *HubManager
+}
+
+func (b *localBroadcaster) Publish(ctx context.Context, roomID int64, event *domain.Event) error {
+	b.manager.Deliver(roomID, event)
+	return nil
+}
+
+func (b *localBroadcaster) PublishToUser(ctx context.Context, userID int64, event *domain.Event) error {
+	b.manager.DeliverToUser(userID, event)
+	return nil
+}
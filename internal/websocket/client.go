@@ -1,7 +1,10 @@
 package websocket
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"go-chat/internal/domain"
@@ -16,24 +19,170 @@ const (
 	pongWait = 60 * time.Second
 	// Период отправки ping-сообщений. Должен быть меньше pongWait.
 	pingPeriod = (pongWait * 9) / 10
-	// Максимальный размер сообщения.
-	maxMessageSize = 1024
+	// Максимальный размер входящего кадра. Сообщение может содержать до 1000 символов,
+	// каждый из которых занимает до 4 байт в UTF-8, плюс служебные поля.
+	maxMessageSize = 8192
 )
 
+// Subprotocol - имя подпротокола WebSocket, в котором весь трафик завернут в domain.Event.
+// Клиенты, не запросившие его при подключении, получают только новые сообщения
+// в прежнем формате (голый JSON domain.Message).
+var Subprotocol = fmt.Sprintf("gochat.v%d", domain.ProtocolVersion)
+
+// Типы входящих кадров.
+const (
+	// FrameTypeMessageCreate - новое сообщение в комнату.
+	FrameTypeMessageCreate = "message.create"
+	// FrameTypeReadMark - клиент дочитал комнату до сообщения.
+	FrameTypeReadMark = "read.mark"
+	// FrameTypeTypingStart и FrameTypeTypingStop - пользователь начал или закончил набирать
+	// сообщение. Пока он печатает, клиенту стоит повторять typing.start каждые пару секунд.
+	FrameTypeTypingStart = "typing.start"
+	FrameTypeTypingStop  = "typing.stop"
+)
+
+// InboundFrame - кадр, полученный от клиента через WebSocket.
+// Использует тот же конверт, что и domain.Event, но payload разбирается обработчиком.
+type InboundFrame struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+	// Seq назначается клиентом и возвращается в ack/error,
+	// чтобы клиент мог сопоставить ответ с отправленным кадром.
+	Seq int64 `json:"seq"`
+}
+
+// AckPayload подтверждает, что кадр клиента обработан.
+type AckPayload struct {
+	Seq       int64 `json:"seq"`
+	MessageID int64 `json:"message_id,omitempty"`
+}
+
+// ErrorPayload сообщает клиенту об ошибке обработки его кадра.
+type ErrorPayload struct {
+	Seq   int64  `json:"seq,omitempty"`
+	Error string `json:"error"`
+}
+
+// FrameHandler обрабатывает кадры, полученные от клиента.
+type FrameHandler interface {
+	HandleFrame(client *Client, frame *InboundFrame)
+}
+
 // Client - это посредник между WebSocket-соединением и хабом.
 type Client struct {
 	Hub *Hub
 	// WebSocket-соединение.
 	Conn *websocket.Conn
-	// Буферизированный канал исходящих сообщений.
-	Send chan *domain.Message
+	// Буферизированный канал исходящих событий.
+	Send chan *domain.Event
 	// ID пользователя из JWT.
 	UserID int64
+	// Имя пользователя из JWT.
+	Username string
+	// ID сессии из JWT. Соединение закрывается, когда сессию отзывают.
+	SessionID int64
 	// ID комнаты, к которой подключен клиент.
 	RoomID int64
+	// Обработчик входящих кадров.
+	Handler FrameHandler
+	// Legacy - клиент не запросил Subprotocol и ожидает голые сообщения.
+	Legacy bool
+
+	// mu защищает closed: канал Send закрывает хаб, а писать в него может и ReadPump.
+	mu     sync.Mutex
+	closed bool
+	// Порядковый номер последнего отправленного события. Используется только в WritePump.
+	seq int64
+	// Канал, по которому WritePump получит пропущенные сообщения. nil, если их не будет.
+	replayCh chan []domain.Message
+	// Пропущенные клиентом сообщения, которые WritePump отправит до живых событий.
+	replay []*domain.Event
+	// ID сообщений из replay. Живые события с этими ID уже доставлены и отбрасываются.
+	replayed map[int64]struct{}
+	// Живые события, пришедшие из хаба, пока WritePump ждал и отправлял replay.
+	backlog []*domain.Event
+}
+
+// ExpectReplay сообщает, что клиенту будут досланы сообщения, пропущенные за время
+// переподключения. Вызывается после регистрации в хабе и до запуска WritePump.
+// Пока сообщения загружаются, WritePump перекладывает живые события из Send в backlog,
+// чтобы хаб не счел клиента зависшим.
+func (c *Client) ExpectReplay() {
+	c.replayCh = make(chan []domain.Message, 1)
+}
+
+// SetReplay передает WritePump пропущенные сообщения. Вызывается один раз после
+// ExpectReplay. Всё, что хаб разошлет после регистрации, попадет в Send, а дубликаты
+// на стыке будут отброшены. Не блокируется, даже если WritePump уже завершился.
+func (c *Client) SetReplay(messages []domain.Message) {
+	c.replayCh <- messages
 }
 
-// readPump считывает сообщения из WebSocket и передает их в хаб.
+// prepareReplay превращает пропущенные сообщения в события для отправки.
+// Replay может быть больше буфера Send, поэтому WritePump отправляет его первым
+// и попутно продолжает перекладывать живые события в backlog.
+func (c *Client) prepareReplay(messages []domain.Message) {
+	c.replay = make([]*domain.Event, 0, len(messages))
+	c.replayed = make(map[int64]struct{}, len(messages))
+	for i := range messages {
+		c.replay = append(c.replay, domain.NewEvent(domain.EventMessageCreated, &messages[i]))
+		c.replayed[messages[i].ID] = struct{}{}
+	}
+}
+
+// isReplayed сообщает, было ли событие уже доставлено клиенту при восстановлении сессии.
+func (c *Client) isReplayed(event *domain.Event) bool {
+	if len(c.replayed) == 0 || event.Type != domain.EventMessageCreated {
+		return false
+	}
+	message, ok := event.Payload.(*domain.Message)
+	if !ok {
+		return false
+	}
+	if _, ok := c.replayed[message.ID]; !ok {
+		return false
+	}
+	delete(c.replayed, message.ID)
+	return true
+}
+
+// Enqueue ставит событие в очередь на отправку клиенту без блокировки.
+// Возвращает false, если канал уже закрыт или его буфер переполнен.
+func (c *Client) Enqueue(event *domain.Event) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	select {
+	case c.Send <- event:
+		return true
+	default:
+		return false
+	}
+}
+
+// SendAck подтверждает клиенту обработку кадра.
+func (c *Client) SendAck(seq int64, messageID int64) {
+	c.Enqueue(domain.NewEvent(domain.EventAck, &AckPayload{Seq: seq, MessageID: messageID}))
+}
+
+// SendError сообщает клиенту об ошибке обработки кадра.
+func (c *Client) SendError(seq int64, message string) {
+	c.Enqueue(domain.NewEvent(domain.EventError, &ErrorPayload{Seq: seq, Error: message}))
+}
+
+// closeSend закрывает канал Send. Вызывается только хабом.
+func (c *Client) closeSend() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.Send)
+	}
+}
+
+// ReadPump считывает кадры из WebSocket и передает их обработчику.
 func (c *Client) ReadPump() {
 	defer func() {
 		c.Hub.Unregister(c)
@@ -43,37 +192,55 @@ func (c *Client) ReadPump() {
 	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.Conn.SetPongHandler(func(string) error { c.Conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 
-	// В текущей реализации мы не принимаем сообщения от клиента через WebSocket,
-	// так как они отправляются через REST API. Этот цикл нужен для поддержания
-	// соединения и обработки его закрытия.
 	for {
-		_, _, err := c.Conn.ReadMessage()
+		_, data, err := c.Conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("websocket error: %v", err)
 			}
 			break
 		}
+
+		frame := new(InboundFrame)
+		if err := json.Unmarshal(data, frame); err != nil {
+			c.SendError(0, "Invalid frame")
+			continue
+		}
+		if c.Handler == nil {
+			continue
+		}
+		c.Handler.HandleFrame(c, frame)
 	}
 }
 
-// writePump передает сообщения из хаба в WebSocket.
+// WritePump передает события из хаба в WebSocket.
 func (c *Client) WritePump() {
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
 		c.Conn.Close()
 	}()
+
+	if c.replayCh != nil && !c.awaitReplay(ticker) {
+		return
+	}
+	if !c.writeReplay() {
+		return
+	}
+
 	for {
 		select {
-		case message, ok := <-c.Send:
+		case event, ok := <-c.Send:
 			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
 				// Канал был закрыт хабом.
 				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
-			if err := c.Conn.WriteJSON(message); err != nil {
+			if c.isReplayed(event) {
+				continue
+			}
+			if err := c.writeEvent(event); err != nil {
 				log.Printf("error writing json: %v", err)
 				return
 			}
@@ -84,4 +251,93 @@ func (c *Client) WritePump() {
 			}
 		}
 	}
-}
\ No newline at end of file
+}
+
+// awaitReplay ждет пропущенные сообщения, перекладывая живые события в backlog
+// и поддерживая соединение ping-сообщениями. Возвращает false, если соединение нужно закрыть.
+func (c *Client) awaitReplay(ticker *time.Ticker) bool {
+	for {
+		select {
+		case messages := <-c.replayCh:
+			c.prepareReplay(messages)
+			return true
+		case event, ok := <-c.Send:
+			if !ok {
+				// Канал был закрыт хабом.
+				c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return false
+			}
+			c.backlog = append(c.backlog, event)
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return false
+			}
+		}
+	}
+}
+
+// writeReplay отправляет пропущенные сообщения, а затем события, накопившиеся за это время.
+// Возвращает false, если соединение нужно закрыть.
+func (c *Client) writeReplay() bool {
+	for _, event := range c.replay {
+		if !c.drainSend() {
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+			return false
+		}
+		c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := c.writeEvent(event); err != nil {
+			log.Printf("error writing json: %v", err)
+			return false
+		}
+	}
+	c.replay = nil
+
+	for _, event := range c.backlog {
+		if c.isReplayed(event) {
+			continue
+		}
+		c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := c.writeEvent(event); err != nil {
+			log.Printf("error writing json: %v", err)
+			return false
+		}
+	}
+	c.backlog = nil
+	return true
+}
+
+// drainSend без блокировки перекладывает события из Send в backlog.
+// Возвращает false, если хаб закрыл канал.
+func (c *Client) drainSend() bool {
+	for {
+		select {
+		case event, ok := <-c.Send:
+			if !ok {
+				return false
+			}
+			c.backlog = append(c.backlog, event)
+		default:
+			return true
+		}
+	}
+}
+
+// writeEvent записывает событие в соединение в формате, который понимает клиент.
+func (c *Client) writeEvent(event *domain.Event) error {
+	if c.Legacy {
+		// Старые клиенты умеют только отображать новые сообщения.
+		if event.Type != domain.EventMessageCreated {
+			return nil
+		}
+		return c.Conn.WriteJSON(event.Payload)
+	}
+
+	// Одно и то же событие рассылается многим клиентам, поэтому seq проставляется в копии.
+	c.seq++
+	out := *event
+	out.Seq = c.seq
+	return c.Conn.WriteJSON(&out)
+}
@@ -0,0 +1,72 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"go-chat/internal/domain"
+)
+
+func TestClientAwaitingReplayIsNotDropped(t *testing.T) {
+	m := NewHubManager()
+	client := &Client{Send: make(chan *domain.Event, 4), UserID: 1, Username: "alice", RoomID: 1}
+	m.Register(client)
+	client.ExpectReplay()
+
+	// Тикер не сработает за время теста, поэтому соединение не понадобится.
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	done := make(chan bool)
+	go func() { done <- client.awaitReplay(ticker) }()
+
+	// Пока пропущенные сообщения загружаются, в комнату приходит больше событий,
+	// чем помещается в буфер Send, и awaitReplay успевает разбирать очередь.
+	const live = 20
+	for i := range live {
+		m.Deliver(1, domain.NewEvent(domain.EventMessageCreated, &domain.Message{ID: int64(100 + i), RoomID: 1}))
+		deadline := time.Now().Add(time.Second)
+		for len(client.Send) > 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("Send is not drained while the replay is loading")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if online := client.Hub.Online(); len(online) != 1 {
+		t.Fatal("hub dropped the client while its replay was loading")
+	}
+
+	client.SetReplay([]domain.Message{{ID: 99, RoomID: 1}, {ID: 100, RoomID: 1}})
+	select {
+	case ok := <-done:
+		if !ok {
+			t.Fatal("awaitReplay closed the connection")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("awaitReplay did not return after SetReplay")
+	}
+
+	if len(client.replay) != 2 {
+		t.Fatalf("replay has %d events, want 2", len(client.replay))
+	}
+	// Последнее событие хаб мог поставить в Send уже после SetReplay: его отправит
+	// основной цикл WritePump.
+	client.Hub.Unregister(client)
+	events := client.backlog
+	for event := range client.Send {
+		events = append(events, event)
+	}
+	var messages []*domain.Event
+	for _, event := range events {
+		if event.Type == domain.EventMessageCreated {
+			messages = append(messages, event)
+		}
+	}
+	if len(messages) != live {
+		t.Fatalf("got %d live messages, want %d", len(messages), live)
+	}
+	// Сообщение 100 есть и в replay, и среди живых событий: второй раз оно не отправляется.
+	if !client.isReplayed(messages[0]) || client.isReplayed(messages[1]) {
+		t.Fatal("overlap between replay and live events is not deduplicated")
+	}
+}
@@ -1,6 +1,10 @@
 package websocket
 
 import (
+	"slices"
+	"sync"
+	"time"
+
 	"go-chat/internal/domain"
 )
 
@@ -9,8 +13,23 @@ type Hub struct {
 	// Зарегистрированные клиенты.
 	clients map[*Client]bool
 
-	// Входящие сообщения от клиентов для рассылки.
-	broadcast chan *domain.Message
+	// Число соединений каждого пользователя в комнате: пользователь в сети,
+	// пока у него открыто хотя бы одно. Меняется только в Run, читается под mu.
+	users map[int64]*userConnections
+	mu    sync.RWMutex
+
+	// События для рассылки всем клиентам комнаты.
+	broadcast chan *domain.Event
+
+	// События для соединений одного пользователя.
+	direct chan userEvent
+
+	// Индикаторы набора подключенных пользователей. Меняется только в Run.
+	typing map[int64]*typingState
+	// Сигналы о наборе от клиентов и истечение индикаторов без typing.stop.
+	typingSignals chan typingSignal
+	typingExpired chan typingExpiry
+	typingGen     uint64
 
 	// Канал для регистрации клиентов.
 	register chan *Client
@@ -23,59 +42,237 @@ type Hub struct {
 
 	// Менеджер хабов, чтобы хаб мог сам себя удалить.
 	manager *HubManager
+
+	// Закрывается, когда Run завершился. После этого отправки в каналы хаба
+	// не блокируются, а просто отбрасываются.
+	done chan struct{}
+}
+
+// userConnections - соединения одного пользователя в комнате.
+type userConnections struct {
+	username string
+	count    int
+}
+
+// userEvent - событие, адресованное только соединениям пользователя userID.
+type userEvent struct {
+	userID int64
+	event  *domain.Event
 }
 
 func NewHub(roomID int64, manager *HubManager) *Hub {
 	return &Hub{
-		broadcast:  make(chan *domain.Message),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		clients:    make(map[*Client]bool),
-		RoomID:     roomID,
-		manager:    manager,
+		broadcast:     make(chan *domain.Event),
+		direct:        make(chan userEvent),
+		typing:        make(map[int64]*typingState),
+		typingSignals: make(chan typingSignal),
+		typingExpired: make(chan typingExpiry),
+		register:      make(chan *Client),
+		unregister:    make(chan *Client),
+		clients:       make(map[*Client]bool),
+		users:         make(map[int64]*userConnections),
+		RoomID:        roomID,
+		manager:       manager,
+		done:          make(chan struct{}),
 	}
 }
 
-// Broadcast отправляет сообщение в канал broadcast.
-func (h *Hub) Broadcast(message *domain.Message) {
-	h.broadcast <- message
+// Broadcast отправляет событие в канал broadcast.
+func (h *Hub) Broadcast(event *domain.Event) {
+	select {
+	case h.broadcast <- event:
+	case <-h.done:
+	}
 }
 
-// Register регистрирует нового клиента в хабе.
-func (h *Hub) Register(client *Client) {
-	h.register <- client
+// SendToUser отправляет событие только клиентам пользователя userID в этой комнате.
+func (h *Hub) SendToUser(userID int64, event *domain.Event) {
+	select {
+	case h.direct <- userEvent{userID: userID, event: event}:
+	case <-h.done:
+	}
+}
+
+// Register регистрирует нового клиента в хабе. Возвращает false, если хаб уже
+// остановился: тогда клиента нужно зарегистрировать в новом хабе комнаты.
+func (h *Hub) Register(client *Client) bool {
+	select {
+	case h.register <- client:
+		return true
+	case <-h.done:
+		return false
+	}
 }
 
 // Unregister отменяет регистрацию клиента.
 func (h *Hub) Unregister(client *Client) {
-	h.unregister <- client
+	select {
+	case h.unregister <- client:
+	case <-h.done:
+	}
 }
 
+// Online возвращает пользователей, у которых открыто соединение с комнатой на этом экземпляре.
+func (h *Hub) Online() []domain.Presence {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	online := make([]domain.Presence, 0, len(h.users))
+	for userID, conns := range h.users {
+		online = append(online, domain.Presence{
+			UserID:   userID,
+			Username: conns.username,
+			RoomID:   h.RoomID,
+			Status:   domain.PresenceOnline,
+		})
+	}
+	return online
+}
+
+// Run обслуживает хаб, пока в нем есть клиенты. Когда последний клиент уходит,
+// хаб удаляет себя из менеджера и останавливается.
 func (h *Hub) Run() {
+	defer close(h.done)
+
 	for {
 		select {
 		case client := <-h.register:
-			h.clients[client] = true
+			h.addClient(client)
 		case client := <-h.unregister:
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.Send)
-				// Если в комнате не осталось клиентов, удаляем хаб.
-				if len(h.clients) == 0 {
-					h.manager.DeleteHub(h.RoomID)
-				}
+			h.removeClient(client)
+		case event := <-h.broadcast:
+			// Рассылаем событие всем клиентам, подключенным к этому хабу (комнате).
+			h.deliver(event, nil)
+			h.disconnectRemoved(event)
+			// Автор отправил сообщение - значит, больше не печатает.
+			if message, ok := event.Payload.(*domain.Message); ok && event.Type == domain.EventMessageCreated {
+				h.stopTyping(message.UserID)
+			}
+		case s := <-h.typingSignals:
+			if s.typing {
+				h.startTyping(s.userID, s.username)
+			} else {
+				h.stopTyping(s.userID)
 			}
-		case message := <-h.broadcast:
-			// Рассылаем сообщение всем клиентам, подключенным к этому хабу (комнате).
-			for client := range h.clients {
-				// Неблокирующая отправка, чтобы один медленный клиент не тормозил всех остальных.
-				select {
-				case client.Send <- message:
-				default:
-					// Если буфер клиента переполнен, закрываем его соединение.
-					close(client.Send)
-					delete(h.clients, client)
-				}
+		case e := <-h.typingExpired:
+			h.typingTimerFired(e)
+		case e := <-h.direct:
+			h.deliver(e.event, func(client *Client) bool { return client.UserID == e.userID })
+			h.disconnectRemoved(e.event)
+		}
+
+		// Если в комнате не осталось клиентов, удаляем хаб.
+		if len(h.clients) == 0 {
+			h.manager.DeleteHub(h.RoomID, h)
+			return
+		}
+	}
+}
+
+// deliver ставит событие в очередь клиентов, для которых match возвращает true
+// (всех, если match равен nil).
+func (h *Hub) deliver(event *domain.Event, match func(*Client) bool) {
+	var dropped []*Client
+	for client := range h.clients {
+		if match != nil && !match(client) {
+			continue
+		}
+		// Неблокирующая отправка, чтобы один медленный клиент не тормозил всех остальных.
+		if !client.Enqueue(event) {
+			dropped = append(dropped, client)
+		}
+	}
+	// Если буфер клиента переполнен, закрываем его соединение.
+	for _, client := range dropped {
+		h.removeClient(client)
+	}
+}
+
+func (h *Hub) addClient(client *Client) {
+	h.clients[client] = true
+	h.manager.userConnected(client.UserID)
+
+	h.mu.Lock()
+	conns, ok := h.users[client.UserID]
+	if !ok {
+		conns = &userConnections{username: client.Username}
+		h.users[client.UserID] = conns
+	}
+	conns.count++
+	h.mu.Unlock()
+
+	if !ok {
+		h.deliver(h.presenceEvent(client, domain.PresenceOnline), nil)
+	}
+}
+
+// removeClient отключает клиента. Когда у пользователя не остается соединений
+// с комнатой, остальные участники получают событие presence.
+func (h *Hub) removeClient(client *Client) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	delete(h.clients, client)
+	client.closeSend()
+	h.manager.userDisconnected(client.UserID)
+
+	h.mu.Lock()
+	conns := h.users[client.UserID]
+	conns.count--
+	last := conns.count == 0
+	if last {
+		delete(h.users, client.UserID)
+	}
+	h.mu.Unlock()
+
+	if last {
+		h.forgetTyping(client.UserID)
+		h.deliver(h.presenceEvent(client, domain.PresenceOffline), nil)
+	}
+}
+
+func (h *Hub) presenceEvent(client *Client, status string) *domain.Event {
+	presence := &domain.Presence{
+		UserID:   client.UserID,
+		Username: client.Username,
+		RoomID:   h.RoomID,
+		Status:   status,
+	}
+	if status == domain.PresenceOffline {
+		now := time.Now()
+		presence.LastSeenAt = &now
+	}
+	return domain.NewEvent(domain.EventPresence, presence)
+}
+
+// disconnectRemoved закрывает соединения клиентов, потерявших доступ к комнате:
+// исключенного участника, всех, если комната удалена, или открытые в отозванных
+// сессиях. Событие к этому моменту
+// уже поставлено в их очередь, так что клиенты узнают причину отключения.
+func (h *Hub) disconnectRemoved(event *domain.Event) {
+	switch event.Type {
+	case domain.EventMemberRemoved:
+		payload, ok := event.Payload.(*domain.MemberRemovedPayload)
+		if !ok {
+			return
+		}
+		for client := range h.clients {
+			if client.UserID == payload.UserID {
+				h.removeClient(client)
+			}
+		}
+	case domain.EventRoomDeleted:
+		for client := range h.clients {
+			h.removeClient(client)
+		}
+	case domain.EventSessionRevoked:
+		payload, ok := event.Payload.(*domain.SessionRevoked)
+		if !ok {
+			return
+		}
+		for client := range h.clients {
+			if slices.Contains(payload.SessionIDs, client.SessionID) {
+				h.removeClient(client)
 			}
 		}
 	}
@@ -1,19 +1,139 @@
 package websocket
 
 import (
+	"context"
 	"log"
 	"sync"
+	"time"
+
+	"go-chat/internal/domain"
 )
 
+// Время на сохранение момента выхода пользователя из сети.
+const lastSeenTimeout = 5 * time.Second
+
+// PresenceStore сохраняет время, когда пользователь последний раз был в сети.
+type PresenceStore interface {
+	UpdateLastSeen(ctx context.Context, userID int64, at time.Time) error
+}
+
 // HubManager управляет всеми хабами для разных комнат.
 type HubManager struct {
 	hubs map[int64]*Hub
 	mu   sync.RWMutex
+
+	broadcaster Broadcaster
+
+	// Число соединений каждого пользователя во всех комнатах этого экземпляра.
+	connections   map[int64]int
+	presenceMu    sync.RWMutex
+	presenceStore PresenceStore
 }
 
+// NewHubManager создает менеджер, который рассылает события только внутри процесса.
+// Для работы в нескольких экземплярах установите другой Broadcaster через SetBroadcaster.
 func NewHubManager() *HubManager {
-	return &HubManager{
-		hubs: make(map[int64]*Hub),
+	m := &HubManager{
+		hubs:        make(map[int64]*Hub),
+		connections: make(map[int64]int),
+	}
+	m.broadcaster = &localBroadcaster{manager: m}
+	return m
+}
+
+// SetPresenceStore задает, куда сохранять время выхода пользователей из сети.
+// Должен вызываться до начала обработки запросов.
+func (m *HubManager) SetPresenceStore(store PresenceStore) {
+	m.presenceStore = store
+}
+
+// IsOnline сообщает, есть ли у пользователя открытые соединения на этом экземпляре.
+// Присутствие не синхронизируется между экземплярами сервиса.
+func (m *HubManager) IsOnline(userID int64) bool {
+	m.presenceMu.RLock()
+	defer m.presenceMu.RUnlock()
+	return m.connections[userID] > 0
+}
+
+// RoomPresence возвращает пользователей, подключенных к комнате на этом экземпляре.
+func (m *HubManager) RoomPresence(roomID int64) []domain.Presence {
+	hub, ok := m.GetHub(roomID)
+	if !ok {
+		return []domain.Presence{}
+	}
+	return hub.Online()
+}
+
+func (m *HubManager) userConnected(userID int64) {
+	m.presenceMu.Lock()
+	defer m.presenceMu.Unlock()
+	m.connections[userID]++
+}
+
+// userDisconnected уменьшает число соединений пользователя и, если оно было последним,
+// сохраняет время выхода из сети.
+func (m *HubManager) userDisconnected(userID int64) {
+	m.presenceMu.Lock()
+	m.connections[userID]--
+	last := m.connections[userID] <= 0
+	if last {
+		delete(m.connections, userID)
+	}
+	m.presenceMu.Unlock()
+
+	if last && m.presenceStore != nil {
+		// Вызывается из цикла хаба, поэтому не блокируем его запросом к БД.
+		go func(at time.Time) {
+			ctx, cancel := context.WithTimeout(context.Background(), lastSeenTimeout)
+			defer cancel()
+			if err := m.presenceStore.UpdateLastSeen(ctx, userID, at); err != nil {
+				log.Printf("failed to update last seen of user %d: %v", userID, err)
+			}
+		}(time.Now())
+	}
+}
+
+// SetBroadcaster заменяет способ рассылки событий. Должен вызываться до начала обработки запросов.
+func (m *HubManager) SetBroadcaster(b Broadcaster) {
+	m.broadcaster = b
+}
+
+// Broadcast публикует событие для комнаты через Broadcaster,
+// чтобы его получили клиенты на всех экземплярах сервиса.
+func (m *HubManager) Broadcast(ctx context.Context, roomID int64, event *domain.Event) error {
+	return m.broadcaster.Publish(ctx, roomID, event)
+}
+
+// Deliver передает событие хабу комнаты в текущем процессе, если у комнаты есть подписчики.
+func (m *HubManager) Deliver(roomID int64, event *domain.Event) {
+	if hub, ok := m.GetHub(roomID); ok {
+		hub.Broadcast(event)
+	}
+}
+
+// SendToUser публикует событие для всех соединений пользователя, в какой бы комнате
+// они ни были открыты, на всех экземплярах сервиса.
+func (m *HubManager) SendToUser(ctx context.Context, userID int64, event *domain.Event) error {
+	return m.broadcaster.PublishToUser(ctx, userID, event)
+}
+
+// SessionsRevoked сообщает соединениям пользователя об отзыве сессий. Соединения,
+// открытые в этих сессиях, закрываются на всех экземплярах сервиса.
+func (m *HubManager) SessionsRevoked(ctx context.Context, userID int64, sessionIDs []int64) error {
+	return m.SendToUser(ctx, userID, domain.NewEvent(domain.EventSessionRevoked, &domain.SessionRevoked{SessionIDs: sessionIDs}))
+}
+
+// DeliverToUser передает событие соединениям пользователя в текущем процессе.
+func (m *HubManager) DeliverToUser(userID int64, event *domain.Event) {
+	m.mu.RLock()
+	hubs := make([]*Hub, 0, len(m.hubs))
+	for _, hub := range m.hubs {
+		hubs = append(hubs, hub)
+	}
+	m.mu.RUnlock()
+
+	for _, hub := range hubs {
+		hub.SendToUser(userID, event)
 	}
 }
 
@@ -33,6 +153,18 @@ func (m *HubManager) GetOrCreateHub(roomID int64) *Hub {
 	return hub
 }
 
+// Register регистрирует клиента в хабе его комнаты и записывает этот хаб в client.Hub.
+// Если хаб успел остановиться между получением и регистрацией, создается новый.
+func (m *HubManager) Register(client *Client) {
+	for {
+		hub := m.GetOrCreateHub(client.RoomID)
+		client.Hub = hub
+		if hub.Register(client) {
+			return
+		}
+	}
+}
+
 // GetHub получает хаб, если он существует, иначе возвращает nil.
 func (m *HubManager) GetHub(roomID int64) (*Hub, bool) {
 	m.mu.RLock()
@@ -41,12 +173,13 @@ func (m *HubManager) GetHub(roomID int64) (*Hub, bool) {
 	return hub, ok
 }
 
-// DeleteHub удаляет хаб из менеджера.
-func (m *HubManager) DeleteHub(roomID int64) {
+// DeleteHub удаляет хаб из менеджера, если за комнатой все еще закреплен именно он.
+// Остановившийся хаб не должен удалить новый хаб, созданный для той же комнаты.
+func (m *HubManager) DeleteHub(roomID int64, hub *Hub) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if _, ok := m.hubs[roomID]; ok {
+	if m.hubs[roomID] == hub {
 		delete(m.hubs, roomID)
 		log.Printf("Хаб для комнаты %d удален", roomID)
 	}
@@ -0,0 +1,76 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"go-chat/internal/domain"
+)
+
+// waitEvent ждет из очереди клиента событие типа eventType.
+func waitEvent(t *testing.T, client *Client, eventType domain.EventType) *domain.Event {
+	t.Helper()
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case event, ok := <-client.Send:
+			if !ok {
+				t.Fatalf("client queue closed while waiting for %s", eventType)
+			}
+			if event.Type == eventType {
+				return event
+			}
+		case <-deadline:
+			t.Fatalf("no %s event", eventType)
+		}
+	}
+}
+
+func TestStoppedHubDoesNotDeleteItsReplacement(t *testing.T) {
+	m := NewHubManager()
+
+	first := &Client{Send: make(chan *domain.Event, 256), UserID: 1, Username: "first", RoomID: 1}
+	m.Register(first)
+	old := first.Hub
+	old.Unregister(first)
+	select {
+	case <-old.done:
+	case <-time.After(time.Second):
+		t.Fatal("empty hub did not stop")
+	}
+	if _, ok := m.GetHub(1); ok {
+		t.Fatal("stopped hub is still registered in the manager")
+	}
+
+	second := &Client{Send: make(chan *domain.Event, 256), UserID: 2, Username: "second", RoomID: 1}
+	m.Register(second)
+	if second.Hub == old {
+		t.Fatal("client registered in the stopped hub")
+	}
+
+	// Старый хаб мог попасть в снимок DeliverToUser или получить событие от таймера набора.
+	// Отправки в него не блокируются и не трогают новый хаб.
+	sent := make(chan struct{})
+	go func() {
+		old.SendToUser(2, domain.NewEvent(domain.EventPresence, &domain.Presence{}))
+		old.Broadcast(domain.NewEvent(domain.EventPresence, &domain.Presence{}))
+		old.Typing(second, true)
+		if old.Register(second) {
+			t.Error("stopped hub accepted a client")
+		}
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("sending to a stopped hub blocked")
+	}
+
+	if hub, ok := m.GetHub(1); !ok || hub != second.Hub {
+		t.Fatal("replacement hub was removed from the manager")
+	}
+	m.Deliver(1, domain.NewEvent(domain.EventMessageCreated, &domain.Message{ID: 1, RoomID: 1}))
+	waitEvent(t, second, domain.EventMessageCreated)
+
+	second.Hub.Unregister(second)
+}
@@ -0,0 +1,186 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"go-chat/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// Канал Postgres, через который экземпляры сервиса обмениваются событиями.
+	pgChannel = "chat_events"
+	// Postgres ограничивает полезную нагрузку NOTIFY 8000 байтами.
+	maxNotifyPayload = 7999
+	// Пауза перед повторным подключением слушателя.
+	pgReconnectDelay = 2 * time.Second
+	// Сколько хранится событие в event_outbox. Уведомление доходит до слушателей
+	// за миллисекунды, запас нужен на случай медленного чтения.
+	outboxRetention = time.Minute
+	// Время на чтение события из event_outbox.
+	outboxReadTimeout = 5 * time.Second
+)
+
+// pgNotification - формат полезной нагрузки NOTIFY. Задан либо RoomID, либо UserID.
+// Если событие не помещается в NOTIFY, уведомление содержит только OutboxID,
+// а само уведомление сохраняется в event_outbox.
+type pgNotification struct {
+	RoomID   int64           `json:"room_id,omitempty"`
+	UserID   int64           `json:"user_id,omitempty"`
+	Event    json.RawMessage `json:"event,omitempty"`
+	OutboxID int64           `json:"outbox_id,omitempty"`
+}
+
+// PGBroadcaster рассылает события между экземплярами сервиса через Postgres LISTEN/NOTIFY.
+// Публикующий экземпляр получает свое же уведомление и доставляет его локальным хабам
+// тем же путем, что и остальные.
+type PGBroadcaster struct {
+	db      *pgxpool.Pool
+	manager *HubManager
+}
+
+func NewPGBroadcaster(db *pgxpool.Pool, manager *HubManager) *PGBroadcaster {
+	return &PGBroadcaster{db: db, manager: manager}
+}
+
+// Publish отправляет событие комнаты всем экземплярам через pg_notify.
+func (b *PGBroadcaster) Publish(ctx context.Context, roomID int64, event *domain.Event) error {
+	return b.notify(ctx, &pgNotification{RoomID: roomID}, event)
+}
+
+// PublishToUser отправляет событие пользователя всем экземплярам через pg_notify.
+func (b *PGBroadcaster) PublishToUser(ctx context.Context, userID int64, event *domain.Event) error {
+	return b.notify(ctx, &pgNotification{UserID: userID}, event)
+}
+
+func (b *PGBroadcaster) notify(ctx context.Context, n *pgNotification, event *domain.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	n.Event = data
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxNotifyPayload {
+		return b.notifyViaOutbox(ctx, payload)
+	}
+
+	_, err = b.db.Exec(ctx, `SELECT pg_notify($1, $2)`, pgChannel, string(payload))
+	return err
+}
+
+// notifyViaOutbox сохраняет уведомление в event_outbox и рассылает только его ID.
+// Запись и NOTIFY выполняются в одной транзакции: слушатели получат уведомление
+// после фиксации, когда запись уже видна. Заодно удаляются устаревшие записи.
+func (b *PGBroadcaster) notifyViaOutbox(ctx context.Context, payload []byte) error {
+	tx, err := b.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM event_outbox WHERE created_at < $1`, time.Now().Add(-outboxRetention)); err != nil {
+		return err
+	}
+
+	var id int64
+	if err := tx.QueryRow(ctx, `INSERT INTO event_outbox (payload) VALUES ($1) RETURNING id`, string(payload)).Scan(&id); err != nil {
+		return err
+	}
+
+	ref, err := json.Marshal(&pgNotification{OutboxID: id})
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `SELECT pg_notify($1, $2)`, pgChannel, string(ref)); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Listen подписывается на канал и доставляет полученные события в локальные хабы,
+// пока не будет отменен ctx. При обрыве соединения переподключается; события,
+// разосланные в это время, клиенты могут дополучить, переподключившись с параметром since.
+func (b *PGBroadcaster) Listen(ctx context.Context) {
+	for {
+		err := b.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("pg broadcaster: %v, переподключение через %s", err, pgReconnectDelay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pgReconnectDelay):
+		}
+	}
+}
+
+// listen держит отдельное соединение вне пула: соединение с активным LISTEN
+// нельзя возвращать в пул для обычных запросов.
+func (b *PGBroadcaster) listen(ctx context.Context) error {
+	conn, err := pgx.ConnectConfig(ctx, b.db.Config().ConnConfig.Copy())
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgChannel); err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("wait for notification: %w", err)
+		}
+		b.handle(notification.Payload)
+	}
+}
+
+func (b *PGBroadcaster) handle(payload string) {
+	var n pgNotification
+	if err := json.Unmarshal([]byte(payload), &n); err != nil {
+		log.Printf("pg broadcaster: некорректное уведомление: %v", err)
+		return
+	}
+	if n.OutboxID != 0 {
+		if err := b.loadOutbox(&n); err != nil {
+			log.Printf("pg broadcaster: не удалось прочитать событие %d из event_outbox: %v", n.OutboxID, err)
+			return
+		}
+	}
+	event, err := domain.DecodeEvent(n.Event)
+	if err != nil {
+		log.Printf("pg broadcaster: некорректное событие: %v", err)
+		return
+	}
+	if n.UserID != 0 {
+		b.manager.DeliverToUser(n.UserID, event)
+		return
+	}
+	b.manager.Deliver(n.RoomID, event)
+}
+
+// loadOutbox заменяет ссылку на event_outbox сохраненным уведомлением.
+func (b *PGBroadcaster) loadOutbox(n *pgNotification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), outboxReadTimeout)
+	defer cancel()
+
+	var payload string
+	err := b.db.QueryRow(ctx, `SELECT payload FROM event_outbox WHERE id = $1`, n.OutboxID).Scan(&payload)
+	if err != nil {
+		return err
+	}
+	*n = pgNotification{}
+	return json.Unmarshal([]byte(payload), n)
+}
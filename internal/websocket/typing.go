@@ -0,0 +1,158 @@
+package websocket
+
+import (
+	"time"
+
+	"go-chat/internal/domain"
+)
+
+const (
+	// Через сколько индикатор набора гаснет сам, если клиент не прислал typing.stop
+	// и не повторил typing.start.
+	typingTTL = 6 * time.Second
+	// Не чаще этого индикатор одного пользователя (typing.start или typing.stop)
+	// пересылается в комнату.
+	typingThrottle = 2 * time.Second
+)
+
+// typingState - индикатор набора одного пользователя. Состояние хранится, пока пользователь
+// подключен к комнате, даже после typing.stop: иначе чередование start и stop
+// сбрасывало бы ограничение частоты.
+type typingState struct {
+	username string
+	// active - пользователь набирает сообщение.
+	active bool
+	// shown - последним в комнату переслан typing.start, и остальные видят индикатор.
+	shown     bool
+	relayedAt time.Time
+	// timer гасит индикатор через typingTTL, пока active, или пересылает отложенный
+	// typing.stop, когда истечет typingThrottle.
+	timer *time.Timer
+	// gen отличает текущий таймер от сработавших, но уже отмененных.
+	gen uint64
+}
+
+type typingSignal struct {
+	userID   int64
+	username string
+	typing   bool
+}
+
+type typingExpiry struct {
+	userID int64
+	gen    uint64
+}
+
+// Typing передает хабу, что клиент начал (typing = true) или закончил набирать сообщение.
+// Хаб пересылает это остальным пользователям комнаты, но не чаще typingThrottle, и сам
+// гасит индикатор через typingTTL без повторного сигнала. Индикаторы живут только
+// в памяти хаба и видны клиентам этого экземпляра сервиса.
+func (h *Hub) Typing(client *Client, typing bool) {
+	select {
+	case h.typingSignals <- typingSignal{userID: client.UserID, username: client.Username, typing: typing}:
+	case <-h.done:
+	}
+}
+
+func (h *Hub) startTyping(userID int64, username string) {
+	state, ok := h.typing[userID]
+	if !ok {
+		state = &typingState{username: username}
+		h.typing[userID] = state
+	}
+	state.active = true
+	h.resetTypingTimer(userID, state, typingTTL)
+
+	// Пока индикатор показан, повторный typing.start продлевает его у остальных,
+	// но тоже не чаще typingThrottle. Пропущенный start клиент повторит сам.
+	if time.Since(state.relayedAt) < typingThrottle {
+		return
+	}
+	state.shown = true
+	h.relayTyping(userID, state, true)
+}
+
+// stopTyping гасит индикатор пользователя. Если с прошлой пересылки не прошло
+// typingThrottle, typing.stop пересылается по таймеру, когда интервал истечет.
+func (h *Hub) stopTyping(userID int64) {
+	state, ok := h.typing[userID]
+	if !ok || !state.active {
+		return
+	}
+	state.active = false
+	state.timer.Stop()
+	if !state.shown {
+		return
+	}
+
+	if wait := typingThrottle - time.Since(state.relayedAt); wait > 0 {
+		h.resetTypingTimer(userID, state, wait)
+		return
+	}
+	h.relayStop(userID, state)
+}
+
+// typingTimerFired обрабатывает сработавший таймер индикатора.
+func (h *Hub) typingTimerFired(e typingExpiry) {
+	state, ok := h.typing[e.userID]
+	if !ok || state.gen != e.gen {
+		return
+	}
+	if state.active {
+		h.stopTyping(e.userID)
+		return
+	}
+	if state.shown {
+		h.relayStop(e.userID, state)
+	}
+}
+
+// forgetTyping гасит индикатор пользователя, который отключился от комнаты, и удаляет
+// его состояние. Остальные в этот момент и так получают presence offline.
+func (h *Hub) forgetTyping(userID int64) {
+	state, ok := h.typing[userID]
+	if !ok {
+		return
+	}
+	state.timer.Stop()
+	delete(h.typing, userID)
+	if state.shown {
+		h.deliverTyping(userID, state.username, false)
+	}
+}
+
+func (h *Hub) resetTypingTimer(userID int64, state *typingState, d time.Duration) {
+	if state.timer != nil {
+		state.timer.Stop()
+	}
+	h.typingGen++
+	state.gen = h.typingGen
+	expiry := typingExpiry{userID: userID, gen: state.gen}
+	state.timer = time.AfterFunc(d, func() {
+		select {
+		case h.typingExpired <- expiry:
+		case <-h.done:
+		}
+	})
+}
+
+func (h *Hub) relayStop(userID int64, state *typingState) {
+	state.shown = false
+	h.relayTyping(userID, state, false)
+}
+
+func (h *Hub) relayTyping(userID int64, state *typingState, typing bool) {
+	state.relayedAt = time.Now()
+	h.deliverTyping(userID, state.username, typing)
+}
+
+// deliverTyping рассылает индикатор всем, кроме соединений самого пользователя.
+func (h *Hub) deliverTyping(userID int64, username string, typing bool) {
+	event := domain.NewEvent(domain.EventTyping, &domain.Typing{
+		RoomID:   h.RoomID,
+		UserID:   userID,
+		Username: username,
+		Typing:   typing,
+	})
+	h.deliver(event, func(client *Client) bool { return client.UserID != userID })
+}
@@ -0,0 +1,77 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"go-chat/internal/domain"
+)
+
+// typingEvents собирает индикаторы набора из очереди клиента за время wait.
+func typingEvents(client *Client, wait time.Duration) []bool {
+	var got []bool
+	deadline := time.After(wait)
+	for {
+		select {
+		case event := <-client.Send:
+			if event.Type == domain.EventTyping {
+				got = append(got, event.Payload.(*domain.Typing).Typing)
+			}
+		case <-deadline:
+			return got
+		}
+	}
+}
+
+func TestTypingThrottlesStartStopSpam(t *testing.T) {
+	hub := NewHubManager().GetOrCreateHub(1)
+	typist := &Client{Hub: hub, Send: make(chan *domain.Event, 256), UserID: 1, Username: "typist"}
+	watcher := &Client{Hub: hub, Send: make(chan *domain.Event, 256), UserID: 2, Username: "watcher"}
+	hub.Register(typist)
+	hub.Register(watcher)
+	defer hub.Unregister(typist)
+	defer hub.Unregister(watcher)
+
+	for range 20 {
+		hub.Typing(typist, true)
+		hub.Typing(typist, false)
+	}
+
+	// Сразу пересылается только первый typing.start, остальное упирается в typingThrottle.
+	if got := typingEvents(watcher, typingThrottle/2); len(got) != 1 || !got[0] {
+		t.Fatalf("events during spam = %v, want a single typing.start", got)
+	}
+
+	// Последний сигнал - stop, поэтому индикатор гаснет, когда истечет интервал.
+	if got := typingEvents(watcher, typingThrottle); len(got) != 1 || got[0] {
+		t.Fatalf("events after throttle = %v, want a single deferred typing.stop", got)
+	}
+
+	// Повторные stop без start ничего не пересылают.
+	hub.Typing(typist, false)
+	if got := typingEvents(watcher, 100*time.Millisecond); len(got) != 0 {
+		t.Fatalf("events after repeated stop = %v, want none", got)
+	}
+}
+
+func TestTypingStartAfterStopIsThrottled(t *testing.T) {
+	hub := NewHubManager().GetOrCreateHub(1)
+	typist := &Client{Hub: hub, Send: make(chan *domain.Event, 256), UserID: 1, Username: "typist"}
+	watcher := &Client{Hub: hub, Send: make(chan *domain.Event, 256), UserID: 2, Username: "watcher"}
+	hub.Register(typist)
+	hub.Register(watcher)
+	defer hub.Unregister(typist)
+	defer hub.Unregister(watcher)
+
+	hub.Typing(typist, true)
+	if got := typingEvents(watcher, typingThrottle+100*time.Millisecond); len(got) != 1 || !got[0] {
+		t.Fatalf("events = %v, want typing.start", got)
+	}
+
+	// stop пересылается сразу, а start сразу после него уже нет.
+	hub.Typing(typist, false)
+	hub.Typing(typist, true)
+	if got := typingEvents(watcher, typingThrottle/2); len(got) != 1 || got[0] {
+		t.Fatalf("events = %v, want only typing.stop", got)
+	}
+}